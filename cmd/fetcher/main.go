@@ -3,16 +3,25 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
-	"syscall"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/zcubbs/sbomer/config"
 	"github.com/zcubbs/sbomer/internal/db"
 	"github.com/zcubbs/sbomer/internal/fetcher"
+	gl "github.com/zcubbs/sbomer/internal/gitlab"
+	"github.com/zcubbs/sbomer/internal/health"
+	"github.com/zcubbs/sbomer/internal/leader"
+	"github.com/zcubbs/sbomer/internal/logging"
+	"github.com/zcubbs/sbomer/internal/metrics"
 	"github.com/zcubbs/sbomer/internal/rabbitmq"
+	"github.com/zcubbs/sbomer/internal/redact"
+	"github.com/zcubbs/sbomer/internal/server"
+	"github.com/zcubbs/sbomer/internal/tracing"
 )
 
 func encodeAMQPVhost(uri string) string {
@@ -30,18 +39,103 @@ func encodeAMQPVhost(uri string) string {
 	return uri
 }
 
-func main() {
-	log.SetOutput(os.Stdout)
-	log.SetFlags(log.Ldate | log.Ltime | log.LUTC)
+// gitlabCheckName names the readiness check of a GitLab instance
+func gitlabCheckName(instance string) string {
+	if instance == config.DefaultInstance {
+		return "gitlab"
+	}
+	return "gitlab:" + instance
+}
+
+// rateLimit converts the rate limit of an instance for the GitLab client
+func rateLimit(c *config.RateLimitConfig) gl.RateLimit {
+	return gl.RateLimit{
+		RequestsPerSecond: c.RequestsPerSecond,
+		Burst:             c.Burst,
+		MaxRetries:        c.MaxRetries,
+		MaxRetryDelay:     time.Duration(c.MaxRetryDelaySecs) * time.Second,
+	}
+}
+
+// schedules returns the fetcher schedules that apply to an instance
+func schedules(cfg *config.Config, instance string) []fetcher.Schedule {
+	var schedules []fetcher.Schedule
+	for _, schedule := range cfg.GetSchedules(instance) {
+		schedules = append(schedules, fetcher.Schedule{
+			Name:     schedule.Name,
+			Schedule: schedule.Schedule,
+			GroupIDs: schedule.GroupIDs,
+			Topics:   schedule.Topics,
+			Priority: uint8(schedule.Priority),
+		})
+	}
+	return schedules
+}
 
-	log.Println("Starting sbomer fetcher...")
-	log.Println("Loading configuration...")
+// fatal logs err and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, logging.Err(err))
+	os.Exit(1)
+}
 
+func main() {
 	// Load configuration
 	cfg, err := config.LoadConfig("")
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal(slog.Default(), "failed to load configuration", err)
+	}
+
+	// Set up logging
+	logger, err := logging.New(cfg.App.LogLevel, cfg.App.LogFormat)
+	if err != nil {
+		fatal(slog.Default(), "failed to set up logging", err)
+	}
+	slog.SetDefault(logger)
+
+	// Keep credentials out of logs and stored errors
+	for _, secret := range cfg.Credentials() {
+		redact.AddSecret(secret)
+	}
+
+	if err := cfg.Validate(config.RoleFetcher); err != nil {
+		fatal(logger, "invalid configuration", err)
+	}
+
+	logger.Info("starting sbomer fetcher", slog.String("log_level", cfg.App.LogLevel))
+
+	// Set up tracing
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		Enabled:     cfg.Tracing.Enabled,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: "sbomer-fetcher",
+	})
+	if err != nil {
+		fatal(logger, "failed to set up tracing", err)
 	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			logger.Warn("failed to flush traces", logging.Err(err))
+		}
+	}()
+
+	// Start operational HTTP server
+	checker := health.New()
+	httpServer := server.New(cfg.Server.FetcherAddr, logger)
+	httpServer.Handle("/metrics", metrics.Handler())
+	httpServer.Handle("/livez", checker.LivenessHandler())
+	httpServer.Handle("/readyz", checker.ReadinessHandler())
+	httpServer.Start()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("failed to shutdown HTTP server", logging.Err(err))
+		}
+	}()
 
 	// Create context that will be canceled on SIGINT or SIGTERM
 	ctx, cancel := context.WithCancel(context.Background())
@@ -52,14 +146,14 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		sig := <-sigChan
-		log.Printf("Received signal %v, shutting down...", sig)
+		logger.Info("received signal, shutting down", slog.String("signal", sig.String()))
 		cancel()
 	}()
 
 	// Initialize database connection
 	database, err := db.New(ctx, cfg.GetDatabaseURI())
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal(logger, "failed to initialize database", err)
 	}
 	defer database.Close()
 
@@ -70,45 +164,134 @@ func main() {
 		ExchangeType:  cfg.AMQP.ExchangeType,
 		RoutingKey:    cfg.AMQP.RoutingKey,
 		ConsumerGroup: cfg.AMQP.ConsumerGroup,
+		MaxPriority:   cfg.AMQP.MaxPriority,
 	}
 
 	publisher, err := rabbitmq.New(rabbitConfig)
 	if err != nil {
-		log.Fatalf("Failed to create RabbitMQ publisher: %v", err)
+		fatal(logger, "failed to create RabbitMQ publisher", err)
 	}
 	defer publisher.Close()
 
-	// Create fetcher service
-	fetcherConfig := fetcher.Config{
-		GitLabToken:   cfg.GitLab.Token,
-		GitLabURL:     fmt.Sprintf("%s://%s", cfg.GitLab.Scheme, cfg.GitLab.Host),
-		Schedule:      cfg.Fetcher.Schedule,
-		BatchSize:     cfg.Fetcher.BatchSize,
-		CoolOffSecs:   cfg.Fetcher.CoolOffSecs,
-		GroupIDs:      cfg.Fetcher.GroupIDs,
-		ExcludeTopics: cfg.Fetcher.ExcludeTopics,
-		IncludeTopics: cfg.Fetcher.IncludeTopics,
-		Publisher:     publisher,
-		DB:            database,
-	}
-
-	service, err := fetcher.New(fetcherConfig)
-	if err != nil {
-		log.Fatalf("Failed to create fetcher service: %v", err)
+	// Run fetch cycles on one replica only
+	var elector *leader.Elector
+	if cfg.Fetcher.LeaderElection.Enabled {
+		elector = leader.New(leader.Config{
+			DB:            database,
+			LockName:      cfg.Fetcher.LeaderElection.LockName,
+			ID:            cfg.GetLeaderID(),
+			CheckInterval: time.Duration(cfg.Fetcher.LeaderElection.CheckIntervalSecs) * time.Second,
+			Logger:        logger,
+		})
+		elector.Start(ctx)
+		defer elector.Stop()
+	}
+
+	// Create a fetcher service per GitLab instance, picking up rotated tokens
+	services := make(map[string]*fetcher.Service)
+	for _, instance := range cfg.GetInstances() {
+		instanceLogger := logger.With(logging.Instance(instance.Name))
+
+		token := gl.NewToken(instance.Token)
+		cfg.WatchSecret(ctx, cfg.InstanceTokenKey(instance.Name), func(value string) {
+			redact.AddSecret(value)
+			token.Set(value)
+			instanceLogger.Info("refreshed GitLab token")
+		}, func(err error) {
+			instanceLogger.Warn("failed to refresh GitLab token", logging.Err(err))
+		})
+
+		service, err := fetcher.New(fetcher.Config{
+			Instance:      instance.Name,
+			GitLabToken:   token,
+			GitLabURL:     fmt.Sprintf("%s://%s", instance.Scheme, instance.Host),
+			Schedule:      cfg.Fetcher.Schedule,
+			BatchSize:     cfg.Fetcher.BatchSize,
+			CoolOffSecs:   cfg.Fetcher.CoolOffSecs,
+			GroupIDs:      instance.GroupIDs,
+			AllGroups:     instance.AllGroups,
+			ExcludeGroups: instance.ExcludeGroups,
+			ExcludeTopics: instance.ExcludeTopics,
+			IncludeTopics: instance.IncludeTopics,
+			DedupTTLSecs:  cfg.Fetcher.DedupTTLSecs,
+			Concurrency:   cfg.Fetcher.Concurrency,
+			Priority:      uint8(cfg.Fetcher.Priority),
+			Schedules:     schedules(cfg, instance.Name),
+			Publisher:     publisher,
+			DB:            database,
+			Logger:        logger,
+			Elector:       elector,
+			RateLimit:     rateLimit(instance.RateLimit),
+		})
+		if err != nil {
+			fatal(instanceLogger, "failed to create fetcher service", err)
+		}
+		defer service.Stop()
+		services[instance.Name] = service
+	}
+
+	// Register health checks
+	checker.AddReadiness("database", database.Ping)
+	checker.AddReadiness("amqp", publisher.Ping)
+	for name, service := range services {
+		checker.AddReadiness(gitlabCheckName(name), service.Ping)
 	}
-	defer service.Stop()
 
-	// Start the service
-	if err := service.Start(ctx); err != nil {
-		log.Fatalf("Failed to start fetcher service: %v", err)
+	// Start the services
+	for name, service := range services {
+		if err := service.Start(ctx); err != nil {
+			fatal(logger.With(logging.Instance(name)), "failed to start fetcher service", err)
+		}
 	}
+	checker.MarkReady()
 
 	// For "once" mode, we're done after the service completes
 	if cfg.Fetcher.Schedule == "once" {
 		return
 	}
 
+	// Apply changes to the config file without a restart
+	if config.Watch(func(newCfg *config.Config, err error) {
+		if err != nil {
+			logger.Warn("ignoring configuration change", logging.Err(err))
+			return
+		}
+		// Secrets may have changed along with the settings
+		for _, secret := range newCfg.Credentials() {
+			redact.AddSecret(secret)
+		}
+		if err := newCfg.Validate(config.RoleFetcher); err != nil {
+			logger.Warn("ignoring invalid configuration change", logging.Err(err))
+			return
+		}
+		for _, instance := range newCfg.GetInstances() {
+			service, ok := services[instance.Name]
+			if !ok {
+				logger.Warn("ignoring new GitLab instance until restart", logging.Instance(instance.Name))
+				continue
+			}
+			if err := service.Update(ctx, fetcher.Settings{
+				Schedule:      newCfg.Fetcher.Schedule,
+				BatchSize:     newCfg.Fetcher.BatchSize,
+				CoolOffSecs:   newCfg.Fetcher.CoolOffSecs,
+				GroupIDs:      instance.GroupIDs,
+				AllGroups:     instance.AllGroups,
+				ExcludeGroups: instance.ExcludeGroups,
+				ExcludeTopics: instance.ExcludeTopics,
+				IncludeTopics: instance.IncludeTopics,
+				DedupTTLSecs:  newCfg.Fetcher.DedupTTLSecs,
+				Concurrency:   newCfg.Fetcher.Concurrency,
+				Priority:      uint8(newCfg.Fetcher.Priority),
+				Schedules:     schedules(newCfg, instance.Name),
+			}); err != nil {
+				logger.Warn("failed to apply configuration change", logging.Instance(instance.Name), logging.Err(err))
+			}
+		}
+	}) {
+		logger.Info("watching configuration file for changes")
+	}
+
 	// For scheduled mode, wait for context cancellation
 	<-ctx.Done()
-	log.Println("Shutting down fetcher service...")
+	logger.Info("shutting down fetcher service")
 }
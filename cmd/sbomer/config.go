@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zcubbs/sbomer/config"
+	"github.com/zcubbs/sbomer/internal/redact"
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = `usage: sbomer config <command> [flags]
+
+commands:
+  validate  check the configuration and report every problem found
+  print     print the effective configuration as YAML
+`
+
+// runConfigCommand runs a "sbomer config" subcommand and returns the exit code
+func runConfigCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, configUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "validate":
+		return runConfigValidate(args[1:], stdout, stderr)
+	case "print":
+		return runConfigPrint(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown config command: %s\n\n%s", args[0], configUsage)
+		return 2
+	}
+}
+
+func runConfigValidate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "directory containing config.yaml")
+	role := flags.String("for", "all", "binary to validate for: fetcher, sbomer or all")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var roles []config.Role
+	switch *role {
+	case "all":
+		roles = []config.Role{config.RoleFetcher, config.RoleSbomer}
+	case string(config.RoleFetcher), string(config.RoleSbomer):
+		roles = []config.Role{config.Role(*role)}
+	default:
+		fmt.Fprintf(stderr, "unknown binary: %s\n", *role)
+		return 2
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(stderr, redact.Error(err))
+		return 1
+	}
+	for _, secret := range cfg.Credentials() {
+		redact.AddSecret(secret)
+	}
+
+	if err := cfg.Validate(roles...); err != nil {
+		var validationErr *config.ValidationError
+		if errors.As(err, &validationErr) {
+			fmt.Fprintln(stderr, redact.String(validationErr.Error()))
+		} else {
+			fmt.Fprintln(stderr, redact.Error(err))
+		}
+		return 1
+	}
+
+	fmt.Fprintln(stdout, "configuration is valid")
+	return 0
+}
+
+func runConfigPrint(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "directory containing config.yaml")
+	redacted := flags.Bool("redacted", false, "replace secrets with "+redact.Placeholder)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(stderr, redact.Error(err))
+		return 1
+	}
+	if *redacted {
+		for _, secret := range cfg.Credentials() {
+			redact.AddSecret(secret)
+		}
+	}
+
+	out, err := yaml.Marshal(cfg.Settings(*redacted))
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to encode configuration: %v\n", err)
+		return 1
+	}
+	if _, err := stdout.Write(out); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// handleSubcommand runs a subcommand given on the command line, exiting when it is done
+func handleSubcommand() {
+	if len(os.Args) < 2 {
+		return
+	}
+
+	switch os.Args[1] {
+	case "config":
+		os.Exit(runConfigCommand(os.Args[2:], os.Stdout, os.Stderr))
+	case "projects":
+		os.Exit(runProjectsCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+}
@@ -2,19 +2,31 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
 	"os"
 	"os/signal"
-	"syscall"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/rabbitmq/amqp091-go"
 	"github.com/zcubbs/sbomer/config"
+	"github.com/zcubbs/sbomer/internal/artifact"
 	"github.com/zcubbs/sbomer/internal/db"
+	"github.com/zcubbs/sbomer/internal/failure"
 	"github.com/zcubbs/sbomer/internal/gitlab"
+	"github.com/zcubbs/sbomer/internal/health"
+	"github.com/zcubbs/sbomer/internal/logging"
+	"github.com/zcubbs/sbomer/internal/metrics"
+	"github.com/zcubbs/sbomer/internal/proc"
 	"github.com/zcubbs/sbomer/internal/processor"
 	"github.com/zcubbs/sbomer/internal/rabbitmq"
+	"github.com/zcubbs/sbomer/internal/redact"
+	"github.com/zcubbs/sbomer/internal/server"
 	"github.com/zcubbs/sbomer/internal/syft"
+	"github.com/zcubbs/sbomer/internal/tracing"
 )
 
 func encodeAMQPVhost(uri string) string {
@@ -32,53 +44,182 @@ func encodeAMQPVhost(uri string) string {
 	return uri
 }
 
-func main() {
-	// Set up logging
-	log.SetOutput(os.Stdout)
-	log.SetFlags(log.Ldate | log.Ltime | log.LUTC)
+// gitlabCheckName names the readiness check of a GitLab instance
+func gitlabCheckName(instance string) string {
+	if instance == config.DefaultInstance {
+		return "gitlab"
+	}
+	return "gitlab:" + instance
+}
+
+// rateLimit converts the rate limit of an instance for the GitLab client
+func rateLimit(c *config.RateLimitConfig) gitlab.RateLimit {
+	return gitlab.RateLimit{
+		RequestsPerSecond: c.RequestsPerSecond,
+		Burst:             c.Burst,
+		MaxRetries:        c.MaxRetries,
+		MaxRetryDelay:     time.Duration(c.MaxRetryDelaySecs) * time.Second,
+	}
+}
 
-	fmt.Println("Starting sbomer...")
-	fmt.Println("Loading configuration...")
+// fatal logs err and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, logging.Err(err))
+	os.Exit(1)
+}
+
+func main() {
+	handleSubcommand()
 
 	// Load configuration
 	cfg, err := config.LoadConfig("")
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal(slog.Default(), "failed to load configuration", err)
+	}
+
+	// Set up logging
+	logger, err := logging.New(cfg.App.LogLevel, cfg.App.LogFormat)
+	if err != nil {
+		fatal(slog.Default(), "failed to set up logging", err)
+	}
+	slog.SetDefault(logger)
+
+	// Keep credentials out of logs and stored errors
+	for _, secret := range cfg.Credentials() {
+		redact.AddSecret(secret)
+	}
+
+	if err := cfg.Validate(config.RoleSbomer); err != nil {
+		fatal(logger, "invalid configuration", err)
+	}
+
+	logger.Info("starting sbomer", slog.String("log_level", cfg.App.LogLevel))
+
+	// Set up tracing
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		Enabled:     cfg.Tracing.Enabled,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: "sbomer",
+	})
+	if err != nil {
+		fatal(logger, "failed to set up tracing", err)
 	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			logger.Warn("failed to flush traces", logging.Err(err))
+		}
+	}()
 
-	fmt.Printf("Configuration loaded successfully. Log level: %s\n", cfg.App.LogLevel)
+	// Start operational HTTP server
+	checker := health.New()
+	httpServer := server.New(cfg.Server.SbomerAddr, logger)
+	httpServer.Handle("/metrics", metrics.Handler())
+	httpServer.Handle("/livez", checker.LivenessHandler())
+	httpServer.Handle("/readyz", checker.ReadinessHandler())
+	httpServer.Start()
 
-	// Initialize components
-	fmt.Println("Initializing components...")
+	// Cancel in-flight work on shutdown signals
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// Initialize database connection
-	ctx := context.Background()
 	database, err := db.New(ctx, cfg.GetDatabaseURI())
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal(logger, "failed to initialize database", err)
 	}
 	defer database.Close()
 
-	// Initialize GitLab client
-	gitlabClient, err := gitlab.New(
-		cfg.GitLab.Token,
-		cfg.GitLab.Host,
-		cfg.GitLab.Scheme,
-		cfg.GitLab.TempDir,
-	)
-	if err != nil {
-		log.Fatalf("Failed to initialize GitLab client: %v", err)
+	// Resource limits of git and syft processes
+	limits := proc.Limits{
+		CgroupRoot:  cfg.Sandbox.CgroupRoot,
+		MemoryBytes: int64(cfg.Sandbox.MemoryLimitMB) * 1024 * 1024,
+		CPUs:        cfg.Sandbox.CPULimit,
+	}
+
+	// Initialize a GitLab client per instance, picking up rotated tokens
+	gitlabClients := make(map[string]*gitlab.Client)
+	for _, instance := range cfg.GetInstances() {
+		instanceLogger := logger.With(logging.Instance(instance.Name))
+
+		token := gitlab.NewToken(instance.Token)
+		cfg.WatchSecret(ctx, cfg.InstanceTokenKey(instance.Name), func(value string) {
+			redact.AddSecret(value)
+			token.Set(value)
+			instanceLogger.Info("refreshed GitLab token")
+		}, func(err error) {
+			instanceLogger.Warn("failed to refresh GitLab token", logging.Err(err))
+		})
+
+		client, err := gitlab.New(gitlab.Config{
+			Token:       token,
+			Host:        instance.Host,
+			Scheme:      instance.Scheme,
+			TempDir:     filepath.Join(cfg.GitLab.TempDir, instance.Name),
+			Logger:      instanceLogger,
+			Limits:      limits,
+			MaxRepoSize: int64(cfg.Sandbox.MaxRepoSizeMB) * 1024 * 1024,
+			RateLimit:   rateLimit(instance.RateLimit),
+		})
+		if err != nil {
+			fatal(instanceLogger, "failed to initialize GitLab client", err)
+		}
+		gitlabClients[instance.Name] = client
 	}
 
 	// Initialize SBOM generator
-	sbomGenerator := syft.New(cfg.Syft.Format, cfg.Syft.SyftBinPath)
+	sbomGenerator := syft.New(syft.Config{
+		Format:      cfg.Syft.Format,
+		SyftBinPath: cfg.Syft.SyftBinPath,
+		Logger:      logger,
+		Limits:      limits,
+	})
+
+	// Initialize artifact store for large SBOMs
+	artifactStore, err := artifact.New(ctx, artifact.Config{
+		Backend: cfg.Artifacts.Backend,
+		Filesystem: artifact.FilesystemConfig{
+			Root:    cfg.Artifacts.Filesystem.Root,
+			BaseURL: cfg.Artifacts.Filesystem.BaseURL,
+		},
+		S3: artifact.S3Config{
+			Endpoint:  cfg.Artifacts.S3.Endpoint,
+			Region:    cfg.Artifacts.S3.Region,
+			Bucket:    cfg.Artifacts.S3.Bucket,
+			Prefix:    cfg.Artifacts.S3.Prefix,
+			AccessKey: cfg.Artifacts.S3.AccessKey,
+			SecretKey: cfg.Artifacts.S3.SecretKey,
+			UseSSL:    cfg.Artifacts.S3.UseSSL,
+		},
+	})
+	if err != nil {
+		fatal(logger, "failed to initialize artifact store", err)
+	}
 
 	// Initialize message processor
-	msgProcessor := processor.New(
-		database,
-		gitlabClient,
-		sbomGenerator,
-	)
+	msgProcessor := processor.New(processor.Config{
+		DB:     database,
+		GitLab: gitlabClients,
+		Syft:   sbomGenerator,
+		Events: processor.EventConfig{
+			Format:          cfg.Events.Format,
+			ContentMode:     cfg.Events.ContentMode,
+			Source:          cfg.Events.Source,
+			Type:            cfg.Events.Type,
+			SBOMURLTemplate: cfg.Events.SBOMURLTemplate,
+		},
+		Artifacts:        artifactStore,
+		OffloadThreshold: cfg.Artifacts.ThresholdBytes,
+		Logger:           logger,
+		WorkerID:         cfg.GetWorkerID(),
+		MaxAttempts:      cfg.Processor.MaxAttempts,
+		RetryDelay:       time.Duration(cfg.Processor.RetryDelaySecs) * time.Second,
+		CloneTimeout:     time.Duration(cfg.Processor.CloneTimeoutSecs) * time.Second,
+		GenerateTimeout:  time.Duration(cfg.Processor.GenerateTimeoutSecs) * time.Second,
+	})
 
 	// Initialize RabbitMQ consumer
 	consumer, err := rabbitmq.New(rabbitmq.ConsumerConfig{
@@ -87,7 +228,12 @@ func main() {
 		ExchangeType:  cfg.AMQP.ExchangeType,
 		RoutingKey:    cfg.AMQP.RoutingKey,
 		ConsumerGroup: cfg.AMQP.ConsumerGroup,
+		MaxPriority:   cfg.AMQP.MaxPriority,
 	})
+	if err != nil {
+		fatal(logger, "failed to initialize RabbitMQ consumer", err)
+	}
+	defer consumer.Close()
 
 	// Initialize RabbitMQ echo.sboms.worker-scanner consumer
 	workerScannerConsumer, err := rabbitmq.New(rabbitmq.ConsumerConfig{
@@ -96,36 +242,94 @@ func main() {
 		ExchangeType:  cfg.AMQP_SCANNER.ExchangeType,
 		RoutingKey:    cfg.AMQP_SCANNER.RoutingKey,
 		ConsumerGroup: cfg.AMQP_SCANNER.ConsumerGroup,
+		MaxPriority:   cfg.AMQP_SCANNER.MaxPriority,
 	})
-
 	if err != nil {
-		log.Fatalf("Failed to initialize RabbitMQ consumer: %v", err)
+		fatal(logger, "failed to initialize RabbitMQ scanner publisher", err)
+	}
+	defer workerScannerConsumer.Close()
+
+	// Register health checks
+	checker.AddReadiness("amqp", consumer.Ping)
+	checker.AddReadiness("amqp_scanner", workerScannerConsumer.Ping)
+	checker.AddReadiness("database", database.Ping)
+	checker.AddReadiness("syft", sbomGenerator.Ping)
+	checker.AddReadiness("git", health.Binary("git"))
+	for name, client := range gitlabClients {
+		checker.AddReadiness(gitlabCheckName(name), client.Ping)
 	}
-	defer consumer.Close()
 
 	// Start consuming messages
 	messages, err := consumer.Consume(ctx)
 	if err != nil {
-		log.Fatalf("Failed to start consuming messages: %v", err)
+		fatal(logger, "failed to start consuming messages", err)
 	}
 
-	fmt.Println("Ready to process messages...")
+	checker.MarkReady()
+	logger.Info("ready to process messages")
 
-	// Handle graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Process messages
+	// Process messages until shutdown; cancelling ctx terminates running git and syft
+	// processes and the interrupted job is redelivered
+	done := make(chan struct{})
 	go func() {
-		for msg := range messages {
-			if err := msgProcessor.ProcessMessage(ctx, msg.Body, workerScannerConsumer); err != nil {
-				log.Printf("Error processing message: %v", err)
+		defer close(done)
+		for {
+			var msg amqp091.Delivery
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-messages:
+				if !ok {
+					return
+				}
+				msg = m
+			}
+
+			metrics.QueueDeliveries.Inc()
+			if rabbitmq.IsRetry(msg) {
+				metrics.MessageRetries.Inc()
 			}
+			msgCtx := tracing.Extract(ctx, msg.Headers)
+			err := msgProcessor.ProcessMessage(msgCtx, msg.Body, workerScannerConsumer)
+			if err == nil {
+				msg.Ack(false)
+				continue
+			}
+
+			var retryErr *processor.RetryError
+			if errors.As(err, &retryErr) {
+				logger.Warn("failed to process message, requeueing",
+					logging.Category(failure.CategoryOf(err)),
+					slog.Duration("retry_delay", retryErr.Delay),
+					logging.Err(err),
+				)
+				// Park the message in a delay queue instead of holding the delivery,
+				// which would block the prefetch slot for the whole delay
+				if err := consumer.Retry(context.WithoutCancel(ctx), msg, retryErr.Delay); err != nil {
+					logger.Warn("failed to delay retry, requeueing immediately", logging.Err(err))
+					msg.Nack(false, true)
+				}
+				continue
+			}
+
+			logger.Error("failed to process message", logging.Category(failure.CategoryOf(err)), logging.Err(err))
 			msg.Ack(false)
 		}
 	}()
 
-	// Wait for shutdown signal
-	<-sigChan
-	fmt.Println("\nShutting down gracefully...")
+	// Wait for shutdown signal, or for the deliveries to stop when the AMQP channel or
+	// connection is lost, in which case the process exits to be restarted
+	select {
+	case <-ctx.Done():
+		logger.Info("shutting down gracefully")
+		<-done
+	case <-done:
+		fatal(logger, "stopped consuming messages", errors.New("delivery channel closed"))
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("failed to shutdown HTTP server", logging.Err(err))
+	}
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zcubbs/sbomer/config"
+	"github.com/zcubbs/sbomer/internal/db"
+	"github.com/zcubbs/sbomer/internal/redact"
+)
+
+const projectsUsage = `usage: sbomer projects <command> [flags]
+
+commands:
+  coverage  report how many projects of each instance have an SBOM
+  cleanup   delete the SBOMs of projects marked deleted
+`
+
+// runProjectsCommand runs a "sbomer projects" subcommand and returns the exit code
+func runProjectsCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, projectsUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "coverage":
+		return runProjectsCoverage(args[1:], stdout, stderr)
+	case "cleanup":
+		return runProjectsCleanup(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown projects command: %s\n\n%s", args[0], projectsUsage)
+		return 2
+	}
+}
+
+// openDatabase loads the configuration in configPath and connects to its database
+func openDatabase(ctx context.Context, configPath string) (*db.DB, error) {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range cfg.Credentials() {
+		redact.AddSecret(secret)
+	}
+
+	database, err := db.New(ctx, cfg.GetDatabaseURI())
+	if err != nil {
+		return nil, err
+	}
+	if err := database.Ping(ctx); err != nil {
+		database.Close()
+		return nil, err
+	}
+	return database, nil
+}
+
+func runProjectsCoverage(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("projects coverage", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "directory containing config.yaml")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	database, err := openDatabase(ctx, *configPath)
+	if err != nil {
+		fmt.Fprintln(stderr, redact.Error(err))
+		return 1
+	}
+	defer database.Close()
+
+	coverage, err := database.GetProjectCoverage(ctx)
+	if err != nil {
+		fmt.Fprintln(stderr, redact.Error(err))
+		return 1
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTANCE\tPROJECTS\tARCHIVED\tFILTERED\tIN SCOPE\tCOVERED\tMISSING\tCOVERAGE\tDELETED\tORPHANED SBOMS")
+	for _, c := range coverage {
+		percent := "-"
+		if c.InScope > 0 {
+			percent = fmt.Sprintf("%.1f%%", float64(c.Covered)*100/float64(c.InScope))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%d\t%d\n",
+			c.Instance, c.Projects, c.Archived, c.Filtered, c.InScope, c.Covered, c.Missing, percent, c.Deleted, c.OrphanedSBOMs)
+	}
+	if err := w.Flush(); err != nil {
+		return 1
+	}
+	return 0
+}
+
+func runProjectsCleanup(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("projects cleanup", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "directory containing config.yaml")
+	grace := flags.Duration("grace", 30*24*time.Hour, "only delete SBOMs of projects marked deleted at least this long ago")
+	dryRun := flags.Bool("dry-run", false, "report how many SBOMs would be deleted without deleting them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *grace < 0 {
+		fmt.Fprintln(stderr, "grace must not be negative")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	database, err := openDatabase(ctx, *configPath)
+	if err != nil {
+		fmt.Fprintln(stderr, redact.Error(err))
+		return 1
+	}
+	defer database.Close()
+
+	deletedBefore := time.Now().Add(-*grace)
+	if *dryRun {
+		count, err := database.CountOrphanedSBOMs(ctx, deletedBefore)
+		if err != nil {
+			fmt.Fprintln(stderr, redact.Error(err))
+			return 1
+		}
+		fmt.Fprintf(stdout, "would delete %d orphaned SBOMs\n", count)
+		return 0
+	}
+
+	count, err := database.DeleteOrphanedSBOMs(ctx, deletedBefore)
+	if err != nil {
+		fmt.Fprintln(stderr, redact.Error(err))
+		return 1
+	}
+	fmt.Fprintf(stdout, "deleted %d orphaned SBOMs\n", count)
+	return 0
+}
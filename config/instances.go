@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultInstance names the GitLab instance configured directly under gitlab
+const DefaultInstance = "default"
+
+// instanceNamePattern restricts instance names to what is safe in paths, metrics and messages
+var instanceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// InstanceConfig is a GitLab instance projects are fetched from
+type InstanceConfig struct {
+	Name          string   `mapstructure:"name"`
+	Host          string   `mapstructure:"host"`
+	Scheme        string   `mapstructure:"scheme"`
+	Token         string   `mapstructure:"token"`
+	GroupIDs      []string `mapstructure:"group_ids"`
+	ExcludeTopics []string `mapstructure:"exclude_topics"`
+	IncludeTopics []string `mapstructure:"include_topics"`
+	AllGroups     bool     `mapstructure:"all_groups"`
+	ExcludeGroups []string `mapstructure:"exclude_groups"`
+
+	// RateLimit defaults to gitlab.rate_limit
+	RateLimit *RateLimitConfig `mapstructure:"rate_limit"`
+}
+
+// GetInstances returns the configured GitLab instances. Without gitlab.instances, the
+// single instance configured by gitlab.host, gitlab.token and the fetcher filters is
+// returned under the name "default". Instances without topic filters, group exclusions
+// or a rate limit of their own use the fetcher's and gitlab.rate_limit.
+func (c *Config) GetInstances() []InstanceConfig {
+	if len(c.GitLab.Instances) == 0 {
+		return []InstanceConfig{{
+			Name:          DefaultInstance,
+			Host:          c.GitLab.Host,
+			Scheme:        c.GitLab.Scheme,
+			Token:         c.GitLab.Token,
+			GroupIDs:      c.Fetcher.GroupIDs,
+			ExcludeTopics: c.Fetcher.ExcludeTopics,
+			IncludeTopics: c.Fetcher.IncludeTopics,
+			AllGroups:     c.Fetcher.AllGroups,
+			ExcludeGroups: c.Fetcher.ExcludeGroups,
+			RateLimit:     &c.GitLab.RateLimit,
+		}}
+	}
+
+	instances := make([]InstanceConfig, len(c.GitLab.Instances))
+	for i, instance := range c.GitLab.Instances {
+		if instance.Scheme == "" {
+			instance.Scheme = "https"
+		}
+		if instance.ExcludeTopics == nil {
+			instance.ExcludeTopics = c.Fetcher.ExcludeTopics
+		}
+		if instance.IncludeTopics == nil {
+			instance.IncludeTopics = c.Fetcher.IncludeTopics
+		}
+		if instance.ExcludeGroups == nil {
+			instance.ExcludeGroups = c.Fetcher.ExcludeGroups
+		}
+		if instance.RateLimit == nil {
+			instance.RateLimit = &c.GitLab.RateLimit
+		}
+		instances[i] = instance
+	}
+	return instances
+}
+
+// InstanceTokenKey returns the configuration key holding the token of an instance, for WatchSecret
+func (c *Config) InstanceTokenKey(name string) string {
+	if len(c.GitLab.Instances) == 0 {
+		return "gitlab.token"
+	}
+	return instanceTokenKey(name)
+}
+
+func instanceTokenKey(name string) string {
+	return fmt.Sprintf("gitlab.instances.%s.token", name)
+}
+
+// validateInstances checks gitlab.instances, or the default instance if there are none
+func (c *Config) validateInstances(v *validator) {
+	validateRateLimit(v, "gitlab.rate_limit", c.GitLab.RateLimit)
+
+	if len(c.GitLab.Instances) == 0 {
+		v.required("gitlab.host", c.GitLab.Host, "set it to the GitLab host name, e.g. gitlab.com")
+		v.oneOf("gitlab.scheme", c.GitLab.Scheme, "http", "https")
+		v.required("gitlab.token", c.GitLab.Token, "set SBOMER_GITLAB_TOKEN to a token with read_api and read_repository scopes")
+		v.hostName("gitlab.host", c.GitLab.Host)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for i, instance := range c.GitLab.Instances {
+		prefix := fmt.Sprintf("gitlab.instances[%d]", i)
+		if !instanceNamePattern.MatchString(instance.Name) {
+			v.addf(prefix+".name", "%q is not valid; use up to 64 lowercase letters, digits, - and _", instance.Name)
+		} else if seen[instance.Name] {
+			v.addf(prefix+".name", "%q is used by more than one instance", instance.Name)
+		}
+		seen[instance.Name] = true
+
+		v.required(prefix+".host", instance.Host, "set it to the GitLab host name, e.g. gitlab.example.com")
+		v.hostName(prefix+".host", instance.Host)
+		if instance.Scheme != "" {
+			v.oneOf(prefix+".scheme", instance.Scheme, "http", "https")
+		}
+		v.required(prefix+".token", instance.Token, "set a token with read_api and read_repository scopes, or a file://, env:// or vault:// reference")
+		validateGroupPatterns(v, prefix+".group_ids", instance.GroupIDs)
+		validateGroupPatterns(v, prefix+".exclude_groups", instance.ExcludeGroups)
+		if instance.RateLimit != nil {
+			validateRateLimit(v, prefix+".rate_limit", *instance.RateLimit)
+		}
+	}
+}
+
+func validateRateLimit(v *validator, prefix string, rateLimit RateLimitConfig) {
+	if rateLimit.RequestsPerSecond < 0 {
+		v.addf(prefix+".requests_per_second", "must not be negative; use 0 to disable the limit")
+	}
+	if rateLimit.Burst < 0 {
+		v.addf(prefix+".burst", "must not be negative")
+	}
+	if rateLimit.MaxRetries < 0 {
+		v.addf(prefix+".max_retries", "must not be negative")
+	}
+	if rateLimit.MaxRetryDelaySecs < 0 {
+		v.addf(prefix+".max_retry_delay_secs", "must not be negative")
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/robfig/cron/v3"
+)
+
+// DefaultSchedule names the cycle run on fetcher.schedule
+const DefaultSchedule = "default"
+
+// ScheduleConfig fetches some groups or topics on a schedule of its own, publishing their
+// projects with a priority of its own
+type ScheduleConfig struct {
+	Name     string `mapstructure:"name"`
+	Schedule string `mapstructure:"schedule"`
+	// Instances restricts the schedule to some GitLab instances; empty applies it to all
+	Instances []string `mapstructure:"instances"`
+	// GroupIDs are fetched instead of the instance's groups
+	GroupIDs []string `mapstructure:"group_ids"`
+	// Topics restricts the schedule to projects with one of them
+	Topics   []string `mapstructure:"topics"`
+	Priority int      `mapstructure:"priority"`
+}
+
+// GetSchedules returns the schedules that apply to a GitLab instance
+func (c *Config) GetSchedules(instance string) []ScheduleConfig {
+	var schedules []ScheduleConfig
+	for _, schedule := range c.Fetcher.Schedules {
+		if len(schedule.Instances) == 0 || slices.Contains(schedule.Instances, instance) {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules
+}
+
+// validateSchedules checks fetcher.priority and fetcher.schedules
+func (c *Config) validateSchedules(v *validator) {
+	validatePriority(v, "fetcher.priority", c.Fetcher.Priority, c.AMQP.MaxPriority)
+
+	instances := make(map[string]bool)
+	for _, instance := range c.GetInstances() {
+		instances[instance.Name] = true
+	}
+
+	parser := cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	seen := map[string]bool{DefaultSchedule: true}
+	for i, schedule := range c.Fetcher.Schedules {
+		prefix := fmt.Sprintf("fetcher.schedules[%d]", i)
+		if !instanceNamePattern.MatchString(schedule.Name) {
+			v.addf(prefix+".name", "%q is not valid; use up to 64 lowercase letters, digits, - and _", schedule.Name)
+		} else if seen[schedule.Name] {
+			v.addf(prefix+".name", "%q is used by more than one schedule or is reserved", schedule.Name)
+		}
+		seen[schedule.Name] = true
+
+		if _, err := parser.Parse(schedule.Schedule); err != nil {
+			v.addf(prefix+".schedule", "%q is not a valid cron expression (%v); use \"seconds minutes hours days months weekdays\", e.g. \"0 0 3 * * *\"", schedule.Schedule, err)
+		}
+		if len(schedule.GroupIDs) == 0 && len(schedule.Topics) == 0 {
+			v.addf(prefix, "set group_ids, topics or both; otherwise the schedule fetches the same projects as fetcher.schedule")
+		}
+		validateGroupPatterns(v, prefix+".group_ids", schedule.GroupIDs)
+		for _, instance := range schedule.Instances {
+			if !instances[instance] {
+				v.addf(prefix+".instances", "%q is not a configured GitLab instance", instance)
+			}
+		}
+		validatePriority(v, prefix+".priority", schedule.Priority, c.AMQP.MaxPriority)
+	}
+}
+
+func validatePriority(v *validator, key string, priority, maxPriority int) {
+	switch {
+	case priority < 0:
+		v.addf(key, "must not be negative")
+	case priority > 0 && maxPriority == 0:
+		v.addf(key, "%d has no effect; set amqp.max_priority to use message priorities", priority)
+	case priority > maxPriority:
+		v.addf(key, "%d is out of range; amqp.max_priority allows 0 to %d", priority, maxPriority)
+	}
+}
@@ -0,0 +1,237 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Secret reference schemes. Values without one of these prefixes are used literally.
+const (
+	SchemeFile  = "file://"
+	SchemeEnv   = "env://"
+	SchemeVault = "vault://"
+)
+
+type SecretsConfig struct {
+	// RefreshSecs is how often references are resolved again to pick up rotated secrets; 0 disables it
+	RefreshSecs int         `mapstructure:"refresh_secs"`
+	Vault       VaultConfig `mapstructure:"vault"`
+}
+
+type VaultConfig struct {
+	Address   string `mapstructure:"address"`
+	Token     string `mapstructure:"token"`
+	Namespace string `mapstructure:"namespace"`
+	Mount     string `mapstructure:"mount"`
+}
+
+// secretFields returns the configuration keys and fields that may hold secret references
+func (c *Config) secretFields() map[string]*string {
+	fields := map[string]*string{
+		"gitlab.token":            &c.GitLab.Token,
+		"database.password":       &c.Database.Password,
+		"amqp.uri":                &c.AMQP.URI,
+		"amqp_scanner.uri":        &c.AMQP_SCANNER.URI,
+		"artifacts.s3.access_key": &c.Artifacts.S3.AccessKey,
+		"artifacts.s3.secret_key": &c.Artifacts.S3.SecretKey,
+	}
+	for i := range c.GitLab.Instances {
+		fields[instanceTokenKey(c.GitLab.Instances[i].Name)] = &c.GitLab.Instances[i].Token
+	}
+	return fields
+}
+
+// IsSecretRef reports whether value is a reference to a secret rather than the secret itself
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SchemeFile) ||
+		strings.HasPrefix(value, SchemeEnv) ||
+		strings.HasPrefix(value, SchemeVault)
+}
+
+// resolveSecrets replaces secret references in the configuration with their values,
+// remembering the references for refreshing
+func (c *Config) resolveSecrets(ctx context.Context) error {
+	c.resolver = NewResolver(c.Secrets)
+	c.secretRefs = make(map[string]string)
+
+	for key, field := range c.secretFields() {
+		if !IsSecretRef(*field) {
+			continue
+		}
+
+		value, err := c.resolver.Resolve(ctx, *field)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", key, err)
+		}
+		c.secretRefs[key] = *field
+		*field = value
+	}
+
+	// The Vault token is resolved here only to scrub it from logs, since the resolver
+	// resolves it again for every request. A vault:// token fails once it is used.
+	if c.Secrets.Vault.Token != "" && !strings.HasPrefix(c.Secrets.Vault.Token, SchemeVault) {
+		token, err := c.resolver.Resolve(ctx, c.Secrets.Vault.Token)
+		if err != nil {
+			return fmt.Errorf("failed to resolve secrets.vault.token: %w", err)
+		}
+		c.vaultToken = token
+	}
+
+	return nil
+}
+
+// WatchSecret resolves the reference behind a secret configuration key every
+// secrets.refresh_secs until ctx is done, calling onChange with each new value. It
+// returns immediately if the key holds a literal value or refreshing is disabled.
+func (c *Config) WatchSecret(ctx context.Context, key string, onChange func(string), onError func(error)) {
+	ref, ok := c.secretRefs[key]
+	if !ok || c.Secrets.RefreshSecs <= 0 {
+		return
+	}
+
+	current := *c.secretFields()[key]
+	ticker := time.NewTicker(time.Duration(c.Secrets.RefreshSecs) * time.Second)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			value, err := c.resolver.Resolve(ctx, ref)
+			if err != nil {
+				onError(fmt.Errorf("failed to refresh %s: %w", key, err))
+				continue
+			}
+			if value != current {
+				current = value
+				onChange(value)
+			}
+		}
+	}()
+}
+
+// Resolver resolves secret references
+type Resolver struct {
+	vault      VaultConfig
+	httpClient *http.Client
+}
+
+// NewResolver creates a resolver using the given Vault settings for vault:// references
+func NewResolver(config SecretsConfig) *Resolver {
+	vault := config.Vault
+	if vault.Mount == "" {
+		vault.Mount = "secret"
+	}
+
+	return &Resolver{
+		vault:      vault,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Resolve returns the secret a reference points to, or value itself if it is not a reference:
+//
+//	file:///run/secrets/gitlab-token   contents of the file, without surrounding whitespace
+//	env://GITLAB_TOKEN                 value of the environment variable
+//	vault://sbomer/gitlab#token        key "token" of the KV v2 secret at sbomer/gitlab
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SchemeFile):
+		return r.resolveFile(strings.TrimPrefix(value, SchemeFile))
+	case strings.HasPrefix(value, SchemeEnv):
+		return r.resolveEnv(strings.TrimPrefix(value, SchemeEnv))
+	case strings.HasPrefix(value, SchemeVault):
+		return r.resolveVault(ctx, strings.TrimPrefix(value, SchemeVault))
+	default:
+		return value, nil
+	}
+}
+
+func (r *Resolver) resolveFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (r *Resolver) resolveEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("secret environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// resolveVault reads a key of a secret from a Vault KV version 2 engine
+func (r *Resolver) resolveVault(ctx context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("vault reference must have the form vault://<path>#<key>")
+	}
+	if r.vault.Address == "" {
+		return "", fmt.Errorf("secrets.vault.address is not set")
+	}
+
+	// The Vault token may itself be a file or environment reference, but not a Vault
+	// reference, which would recurse without end
+	if strings.HasPrefix(r.vault.Token, SchemeVault) {
+		return "", fmt.Errorf("secrets.vault.token must be a literal, file:// or env:// reference")
+	}
+	token, err := r.Resolve(ctx, r.vault.Token)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve vault token: %w", err)
+	}
+
+	endpoint, err := url.JoinPath(r.vault.Address, "v1", r.vault.Mount, "data", path)
+	if err != nil {
+		return "", fmt.Errorf("invalid vault address: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if r.vault.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.vault.Namespace)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read vault secret %s: status %d", path, resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode vault secret: %w", err)
+	}
+
+	value, ok := body.Data.Data[key]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %s", path, key)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s key %s is not a string", path, key)
+	}
+	return s, nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newVaultServer stands in for a Vault dev server holding one KV version 2 secret
+func newVaultServer(t *testing.T, token, path string, data map[string]interface{}) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/"+path {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": data},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "vault-token")
+	if err := os.WriteFile(tokenFile, []byte("dev-root-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SBOMER_TEST_SECRET", "from-env")
+
+	server := newVaultServer(t, "dev-root-token", "sbomer/gitlab", map[string]interface{}{
+		"token": "glpat-secret",
+		"count": 3,
+	})
+
+	tests := []struct {
+		name       string
+		vaultToken string
+		value      string
+		want       string
+		wantErr    string
+	}{
+		{name: "literal", value: "plain", want: "plain"},
+		{name: "file", value: "file://" + tokenFile, want: "dev-root-token"},
+		{name: "missing file", value: "file://" + filepath.Join(dir, "missing"), wantErr: "failed to read secret file"},
+		{name: "env", value: "env://SBOMER_TEST_SECRET", want: "from-env"},
+		{name: "unset env", value: "env://SBOMER_TEST_UNSET", wantErr: "is not set"},
+		{name: "vault", vaultToken: "dev-root-token", value: "vault://sbomer/gitlab#token", want: "glpat-secret"},
+		{name: "vault token from file", vaultToken: "file://" + tokenFile, value: "vault://sbomer/gitlab#token", want: "glpat-secret"},
+		{name: "vault wrong token", vaultToken: "other", value: "vault://sbomer/gitlab#token", wantErr: "status 403"},
+		{name: "vault missing key", vaultToken: "dev-root-token", value: "vault://sbomer/gitlab#password", wantErr: "has no key"},
+		{name: "vault non-string key", vaultToken: "dev-root-token", value: "vault://sbomer/gitlab#count", wantErr: "is not a string"},
+		{name: "vault without key", vaultToken: "dev-root-token", value: "vault://sbomer/gitlab", wantErr: "must have the form"},
+		{name: "vault token from vault", vaultToken: "vault://sbomer/gitlab#token", value: "vault://sbomer/gitlab#token", wantErr: "secrets.vault.token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewResolver(SecretsConfig{Vault: VaultConfig{Address: server.URL, Token: tt.vaultToken}})
+
+			got, err := resolver.Resolve(context.Background(), tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve(%q) error = %v, want error containing %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q) error = %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/zcubbs/sbomer/internal/redact"
+)
+
+// Settings returns the effective settings of the last loaded configuration, merged from
+// defaults, the config file and the environment. Secret references are returned as
+// they were configured, not resolved. With redacted set, literal secrets and credentials
+// embedded in other values are replaced.
+func (c *Config) Settings(redacted bool) map[string]interface{} {
+	settings := viper.AllSettings()
+	if !redacted {
+		return settings
+	}
+
+	secretKeys := map[string]bool{
+		"secrets.vault.token":      true,
+		"gitlab.instances.*.token": true,
+	}
+	for key := range c.secretFields() {
+		secretKeys[key] = true
+	}
+	redactSettings(settings, "", secretKeys)
+	return settings
+}
+
+func redactSettings(settings map[string]interface{}, prefix string, secretKeys map[string]bool) {
+	for name, value := range settings {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			redactSettings(v, key, secretKeys)
+		case []interface{}:
+			// Elements of lists share the key prefix <list>.*
+			for _, element := range v {
+				if m, ok := element.(map[string]interface{}); ok {
+					redactSettings(m, key+".*", secretKeys)
+				}
+			}
+		case string:
+			if secretKeys[key] && v != "" && !IsSecretRef(v) && !strings.Contains(v, "://") {
+				settings[name] = redact.Placeholder
+			} else {
+				settings[name] = redact.String(v)
+			}
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/viper"
+)
+
+// Role selects the settings a binary requires
+type Role string
+
+const (
+	RoleFetcher Role = "fetcher"
+	RoleSbomer  Role = "sbomer"
+)
+
+// FieldError describes an invalid configuration key and how to fix it
+type FieldError struct {
+	Key     string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Errors)+1)
+	lines = append(lines, fmt.Sprintf("invalid configuration (%d errors):", len(e.Errors)))
+	for _, fieldErr := range e.Errors {
+		lines = append(lines, "  "+fieldErr.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validator collects field errors
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) addf(key, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(key, value, hint string) {
+	if strings.TrimSpace(value) == "" {
+		v.addf(key, "is required; %s", hint)
+	}
+}
+
+func (v *validator) hostName(key, value string) {
+	if strings.Contains(value, "://") {
+		v.addf(key, "must be a host name without scheme; set the scheme separately")
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.addf(key, "%q is not valid; use one of %s", value, quoteAll(allowed))
+}
+
+// Validate checks the configuration for the settings the given binaries need and returns
+// a *ValidationError listing every problem found
+func (c *Config) Validate(roles ...Role) error {
+	v := &validator{}
+
+	for _, key := range c.unknownKeys {
+		v.addf(key, "unknown key; check for typos or remove it")
+	}
+
+	// Settings shared by all binaries
+	v.oneOf("app.log_level", strings.ToLower(c.App.LogLevel), "debug", "info", "warn", "warning", "error")
+	v.oneOf("app.log_format", strings.ToLower(c.App.LogFormat), "text", "json")
+
+	v.required("database.host", c.Database.Host, "set it or SBOMER_DB_HOST")
+	v.required("database.user", c.Database.User, "set it or SBOMER_DB_USER")
+	v.required("database.dbname", c.Database.DBName, "set it or SBOMER_DB_NAME")
+	if c.Database.Port <= 0 || c.Database.Port > 65535 {
+		v.addf("database.port", "%d is not a valid port", c.Database.Port)
+	}
+
+	c.validateInstances(v)
+
+	c.validateAMQP(v, "amqp", c.AMQP)
+
+	if c.Tracing.Enabled {
+		v.required("tracing.endpoint", c.Tracing.Endpoint, "set it to the OTLP/HTTP collector, e.g. localhost:4318")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		v.addf("tracing.sample_ratio", "%v is not between 0 and 1", c.Tracing.SampleRatio)
+	}
+
+	for _, role := range roles {
+		switch role {
+		case RoleFetcher:
+			c.validateFetcher(v)
+		case RoleSbomer:
+			c.validateSbomer(v)
+		}
+	}
+
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
+
+func (c *Config) validateAMQP(v *validator, prefix string, amqp AMQPConfig) {
+	v.required(prefix+".uri", amqp.URI, "set it to an amqp:// or amqps:// URI")
+	if amqp.URI != "" && !strings.HasPrefix(amqp.URI, "amqp://") && !strings.HasPrefix(amqp.URI, "amqps://") {
+		v.addf(prefix+".uri", "must start with amqp:// or amqps://")
+	}
+	v.required(prefix+".exchange", amqp.Exchange, "set the name of the exchange to use")
+	// Plugins provide further exchange types, which are all prefixed with x-
+	if !strings.HasPrefix(amqp.ExchangeType, "x-") {
+		v.oneOf(prefix+".exchange_type", amqp.ExchangeType, "direct", "fanout", "topic", "headers")
+	}
+	if amqp.MaxPriority < 0 || amqp.MaxPriority > 255 {
+		v.addf(prefix+".max_priority", "%d is out of range; RabbitMQ supports priorities from 0 to 255, and 10 or less is recommended", amqp.MaxPriority)
+	}
+}
+
+func (c *Config) validateFetcher(v *validator) {
+	if c.Fetcher.Schedule != "once" {
+		parser := cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+		if _, err := parser.Parse(c.Fetcher.Schedule); err != nil {
+			v.addf("fetcher.schedule", "%q is not a valid cron expression (%v); use \"once\" or \"seconds minutes hours days months weekdays\", e.g. \"0 0 * * * *\"", c.Fetcher.Schedule, err)
+		}
+	}
+	if c.Fetcher.BatchSize < 1 || c.Fetcher.BatchSize > 100 {
+		v.addf("fetcher.batch_size", "%d is out of range; GitLab returns between 1 and 100 projects per page", c.Fetcher.BatchSize)
+	}
+	if c.Fetcher.CoolOffSecs < 0 {
+		v.addf("fetcher.cool_off_secs", "must not be negative")
+	}
+	if c.Fetcher.DedupTTLSecs < 0 {
+		v.addf("fetcher.dedup_ttl_secs", "must not be negative")
+	}
+	validateGroupPatterns(v, "fetcher.group_ids", c.Fetcher.GroupIDs)
+	validateGroupPatterns(v, "fetcher.exclude_groups", c.Fetcher.ExcludeGroups)
+	if c.Fetcher.Concurrency < 1 {
+		v.addf("fetcher.concurrency", "must be at least 1; use 1 to fetch one group at a time")
+	}
+	c.validateSchedules(v)
+	if c.Fetcher.LeaderElection.Enabled {
+		v.required("fetcher.leader_election.lock_name", c.Fetcher.LeaderElection.LockName, "set the name replicas elect their leader under, e.g. sbomer-fetcher")
+		if c.Fetcher.LeaderElection.CheckIntervalSecs < 1 {
+			v.addf("fetcher.leader_election.check_interval_secs", "must be at least 1")
+		}
+	}
+}
+
+// validateGroupPatterns checks group IDs, paths and glob patterns
+func validateGroupPatterns(v *validator, key string, patterns []string) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" || strings.HasPrefix(pattern, "/") {
+			v.addf(key, "%q is not a group ID, full path or glob pattern like platform/*", pattern)
+		}
+	}
+}
+
+func (c *Config) validateSbomer(v *validator) {
+	c.validateAMQP(v, "amqp_scanner", c.AMQP_SCANNER)
+
+	// SBOMs are stored and published as JSON, so only JSON output formats are supported
+	v.oneOf("syft.format", c.Syft.Format, "cyclonedx-json", "spdx-json", "syft-json", "github-json")
+	if err := checkBinary(c.Syft.SyftBinPath); err != nil {
+		v.addf("syft.syft_bin_path", "%v; install syft or point syft.syft_bin_path at it", err)
+	}
+
+	v.oneOf("events.format", c.Events.Format, "raw", "cloudevents")
+	v.oneOf("events.content_mode", c.Events.ContentMode, "structured", "binary")
+
+	switch c.Artifacts.Backend {
+	case "":
+	case "filesystem":
+		v.required("artifacts.filesystem.root", c.Artifacts.Filesystem.Root, "set the directory to store artifacts in")
+	case "s3":
+		v.required("artifacts.s3.endpoint", c.Artifacts.S3.Endpoint, "set the S3 endpoint, e.g. s3.amazonaws.com")
+		v.required("artifacts.s3.bucket", c.Artifacts.S3.Bucket, "set the bucket to store artifacts in")
+	default:
+		v.oneOf("artifacts.backend", c.Artifacts.Backend, "", "filesystem", "s3")
+	}
+
+	if c.Processor.MaxAttempts < 1 {
+		v.addf("processor.max_attempts", "must be at least 1")
+	}
+	if c.Processor.RetryDelaySecs < 0 {
+		v.addf("processor.retry_delay_secs", "must not be negative")
+	}
+	if c.Processor.CloneTimeoutSecs < 0 {
+		v.addf("processor.clone_timeout_secs", "must not be negative; use 0 to disable the timeout")
+	}
+	if c.Processor.GenerateTimeoutSecs < 0 {
+		v.addf("processor.generate_timeout_secs", "must not be negative; use 0 to disable the timeout")
+	}
+
+	if c.Sandbox.CgroupRoot != "" {
+		if info, err := os.Stat(c.Sandbox.CgroupRoot); err != nil || !info.IsDir() {
+			v.addf("sandbox.cgroup_root", "%s is not a directory; create a delegated cgroup v2 directory or unset it", c.Sandbox.CgroupRoot)
+		}
+	}
+	if c.Sandbox.MemoryLimitMB < 0 || c.Sandbox.CPULimit < 0 || c.Sandbox.MaxRepoSizeMB < 0 {
+		v.addf("sandbox", "limits must not be negative; use 0 to disable them")
+	}
+}
+
+// checkBinary verifies that path names an executable, looking it up in PATH if it is a bare name
+func checkBinary(path string) error {
+	if path == "" {
+		return fmt.Errorf("no binary configured")
+	}
+	if filepath.Base(path) == path {
+		if _, err := exec.LookPath(path); err != nil {
+			return fmt.Errorf("%s not found in PATH", path)
+		}
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s does not exist", path)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+// findUnknownKeys returns the keys set in v that do not correspond to a configuration field
+func findUnknownKeys(v *viper.Viper) []string {
+	known := make(map[string]bool)
+	collectKeys(reflect.TypeOf(Config{}), "", known)
+
+	var unknown []string
+	for _, key := range v.AllKeys() {
+		if !isKnownKey(key, known) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// isKnownKey reports whether key or one of its parents is a known leaf; maps and lists
+// are leaves whose contents are not checked
+func isKnownKey(key string, known map[string]bool) bool {
+	for {
+		if known[key] {
+			return true
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			return false
+		}
+		key = key[:i]
+	}
+}
+
+// collectKeys adds the mapstructure keys of the leaves of t below prefix to known
+func collectKeys(t reflect.Type, prefix string, known map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if !field.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			collectKeys(field.Type, key, known)
+			continue
+		}
+		known[key] = true
+	}
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return strings.Join(quoted, ", ")
+}
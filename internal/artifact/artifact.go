@@ -0,0 +1,82 @@
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// BackendFilesystem stores artifacts in a local directory
+	BackendFilesystem = "filesystem"
+	// BackendS3 stores artifacts in an S3-compatible bucket
+	BackendS3 = "s3"
+
+	digestAlgorithm = "sha256"
+)
+
+// ErrDigestMismatch is returned when stored content does not match its reference digest
+var ErrDigestMismatch = errors.New("artifact digest mismatch")
+
+// Ref is a content-addressed reference to a stored artifact
+type Ref struct {
+	URI       string `json:"uri"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	MediaType string `json:"mediaType"`
+}
+
+// Store uploads and retrieves content-addressed artifacts
+type Store interface {
+	// Put stores data under its digest, skipping the upload if it already exists
+	Put(ctx context.Context, data []byte, mediaType string) (*Ref, error)
+	// Get retrieves and verifies the artifact referenced by ref
+	Get(ctx context.Context, ref *Ref) ([]byte, error)
+}
+
+type Config struct {
+	Backend    string
+	Filesystem FilesystemConfig
+	S3         S3Config
+}
+
+// New creates the store for the configured backend, or nil if no backend is configured
+func New(ctx context.Context, config Config) (Store, error) {
+	switch config.Backend {
+	case "":
+		return nil, nil
+	case BackendFilesystem:
+		return NewFilesystemStore(config.Filesystem)
+	case BackendS3:
+		return NewS3Store(ctx, config.S3)
+	default:
+		return nil, fmt.Errorf("unknown artifact backend: %s", config.Backend)
+	}
+}
+
+// Digest returns the content digest of data in "sha256:<hex>" form
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return digestAlgorithm + ":" + hex.EncodeToString(sum[:])
+}
+
+// objectKey returns the storage key of a digest, fanned out by its first two hex characters
+func objectKey(prefix, digest string) (string, error) {
+	algorithm, hexDigest, ok := strings.Cut(digest, ":")
+	if !ok || algorithm != digestAlgorithm || len(hexDigest) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid artifact digest: %s", digest)
+	}
+	return path.Join(prefix, algorithm, hexDigest[:2], hexDigest), nil
+}
+
+// verify checks that data matches the digest of ref
+func verify(ref *Ref, data []byte) error {
+	if got := Digest(data); got != ref.Digest {
+		return fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, ref.Digest, got)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type FilesystemConfig struct {
+	Root string
+	// BaseURL is the URL the root is served at, e.g. by a web server sharing its volume.
+	// Without it, artifacts are referenced by file:// URIs that only resolve on this host.
+	BaseURL string
+}
+
+// FilesystemStore stores artifacts below a local root directory
+type FilesystemStore struct {
+	root    string
+	baseURL *url.URL
+}
+
+func NewFilesystemStore(config FilesystemConfig) (*FilesystemStore, error) {
+	root, err := filepath.Abs(config.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve artifact root: %w", err)
+	}
+
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact root: %w", err)
+	}
+
+	var baseURL *url.URL
+	if config.BaseURL != "" {
+		baseURL, err = url.Parse(strings.TrimSuffix(config.BaseURL, "/") + "/")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse artifact base URL: %w", err)
+		}
+	}
+
+	return &FilesystemStore{root: root, baseURL: baseURL}, nil
+}
+
+// Put writes data to its content-addressed path, using a rename so readers never see partial files
+func (s *FilesystemStore) Put(ctx context.Context, data []byte, mediaType string) (*Ref, error) {
+	digest := Digest(data)
+	key, err := objectKey("", digest)
+	if err != nil {
+		return nil, err
+	}
+
+	filePath := filepath.Join(s.root, filepath.FromSlash(key))
+	ref := &Ref{
+		URI:       s.uri(key, filePath),
+		Digest:    digest,
+		Size:      int64(len(data)),
+		MediaType: mediaType,
+	}
+
+	if _, err := os.Stat(filePath); err == nil {
+		return ref, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write artifact: %w", err)
+	}
+	// CreateTemp creates files readable by the owner only; artifacts are public, so that
+	// a web server sharing the volume can serve them under BaseURL
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to set artifact mode: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write artifact: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return nil, fmt.Errorf("failed to store artifact: %w", err)
+	}
+
+	return ref, nil
+}
+
+// Get reads the artifact referenced by ref from the root directory
+func (s *FilesystemStore) Get(ctx context.Context, ref *Ref) ([]byte, error) {
+	key, err := objectKey("", ref.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.root, filepath.FromSlash(key)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+
+	if err := verify(ref, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// uri returns the URI consumers fetch the artifact at key from
+func (s *FilesystemStore) uri(key, filePath string) string {
+	if s.baseURL != nil {
+		return s.baseURL.JoinPath(key).String()
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filePath)}).String()
+}
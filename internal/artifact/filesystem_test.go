@@ -0,0 +1,89 @@
+package artifact
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilesystemStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	data := []byte(`{"bomFormat":"CycloneDX"}`)
+
+	store, err := NewFilesystemStore(FilesystemConfig{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := store.Put(ctx, data, "application/vnd.cyclonedx+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Digest != Digest(data) || ref.Size != int64(len(data)) || ref.MediaType != "application/vnd.cyclonedx+json" {
+		t.Fatalf("unexpected ref: %+v", ref)
+	}
+
+	key, _ := objectKey("", ref.Digest)
+	path := filepath.Join(root, filepath.FromSlash(key))
+	if want := "file://" + filepath.ToSlash(path); ref.URI != want {
+		t.Fatalf("URI = %s, want %s", ref.URI, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o644 {
+		t.Fatalf("artifact mode = %o, want 644", mode)
+	}
+
+	// Storing the same content again leaves the artifact as is
+	again, err := store.Put(ctx, data, "application/vnd.cyclonedx+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *again != *ref {
+		t.Fatalf("second Put returned %+v, want %+v", again, ref)
+	}
+
+	got, err := store.Get(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Fatalf("Get = %s, want %s", got, data)
+	}
+
+	if err := os.WriteFile(path, []byte("tampered"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, ref); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("Get of tampered artifact: got %v, want %v", err, ErrDigestMismatch)
+	}
+}
+
+func TestFilesystemStoreBaseURL(t *testing.T) {
+	data := []byte(`{}`)
+
+	for _, baseURL := range []string{"https://artifacts.example.com/sboms", "https://artifacts.example.com/sboms/"} {
+		store, err := NewFilesystemStore(FilesystemConfig{Root: t.TempDir(), BaseURL: baseURL})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ref, err := store.Put(context.Background(), data, "application/json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hexDigest := strings.TrimPrefix(Digest(data), "sha256:")
+		want := "https://artifacts.example.com/sboms/sha256/" + hexDigest[:2] + "/" + hexDigest
+		if ref.URI != want {
+			t.Fatalf("base URL %s: URI = %s, want %s", baseURL, ref.URI, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// S3Store stores artifacts in an S3-compatible bucket such as AWS S3 or MinIO
+type S3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3Store(ctx context.Context, config S3Config) (*S3Store, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", config.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket %s does not exist", config.Bucket)
+	}
+
+	return &S3Store{
+		client: client,
+		bucket: config.Bucket,
+		prefix: config.Prefix,
+	}, nil
+}
+
+// Put uploads data under its digest unless an object with that key already exists
+func (s *S3Store) Put(ctx context.Context, data []byte, mediaType string) (*Ref, error) {
+	digest := Digest(data)
+	key, err := objectKey(s.prefix, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := &Ref{
+		URI:       fmt.Sprintf("s3://%s/%s", s.bucket, key),
+		Digest:    digest,
+		Size:      int64(len(data)),
+		MediaType: mediaType,
+	}
+
+	if _, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{}); err == nil {
+		return ref, nil
+	} else if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return nil, fmt.Errorf("failed to stat artifact: %w", err)
+	}
+
+	_, err = s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: mediaType})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload artifact: %w", err)
+	}
+
+	return ref, nil
+}
+
+// Get downloads the artifact referenced by ref
+func (s *S3Store) Get(ctx context.Context, ref *Ref) ([]byte, error) {
+	key, err := objectKey(s.prefix, ref.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get artifact: %w", err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+
+	if err := verify(ref, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,223 @@
+package artifact
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// s3Server stands in for an S3-compatible server holding one bucket, answering the
+// path-style requests S3Store makes without checking their signatures
+type s3Server struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string]s3Object
+	puts    int
+}
+
+type s3Object struct {
+	data        []byte
+	contentType string
+}
+
+func newS3Server(t *testing.T, bucket string) (*s3Server, *httptest.Server) {
+	t.Helper()
+	s := &s3Server{bucket: bucket, objects: make(map[string]s3Object)}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		s.notFound(w, r, "NoSuchBucket")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key == "" {
+		// HEAD of the bucket checks that it exists
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err == nil && strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			data, err = decodeAWSChunked(data)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.objects[key] = s3Object{data: data, contentType: r.Header.Get("Content-Type")}
+		s.puts++
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead, http.MethodGet:
+		object, ok := s.objects[key]
+		if !ok {
+			s.notFound(w, r, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(object.data)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeAWSChunked strips the chunk headers of a body uploaded with streaming
+// signatures, which minio-go uses over plain HTTP
+func decodeAWSChunked(body []byte) ([]byte, error) {
+	reader := bufio.NewReader(bytes.NewReader(body))
+	var data []byte
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunk header: %w", err)
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk size %q: %w", sizeHex, err)
+		}
+		if size == 0 {
+			return data, nil
+		}
+
+		chunk := make([]byte, size+2) // followed by CRLF
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, fmt.Errorf("failed to read chunk: %w", err)
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+func (s *s3Server) notFound(w http.ResponseWriter, r *http.Request, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusNotFound)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, `<Error><Code>%s</Code><Message>not found</Message></Error>`, code)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	ctx := context.Background()
+	s, server := newS3Server(t, "sbomer")
+	endpoint := strings.TrimPrefix(server.URL, "http://")
+
+	if _, err := NewS3Store(ctx, S3Config{Endpoint: endpoint, Region: "us-east-1", Bucket: "missing"}); err == nil {
+		t.Fatal("NewS3Store with a missing bucket succeeded")
+	}
+
+	store, err := NewS3Store(ctx, S3Config{
+		Endpoint:  endpoint,
+		Region:    "us-east-1",
+		Bucket:    "sbomer",
+		Prefix:    "sboms",
+		AccessKey: "access",
+		SecretKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(`{"bomFormat":"CycloneDX"}`)
+	ref, err := store.Put(ctx, data, "application/vnd.cyclonedx+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := objectKey("sboms", Digest(data))
+	if want := "s3://sbomer/" + key; ref.URI != want {
+		t.Fatalf("URI = %s, want %s", ref.URI, want)
+	}
+	if object := s.objects[key]; string(object.data) != string(data) || object.contentType != "application/vnd.cyclonedx+json" {
+		t.Fatalf("stored object = %q (%s)", object.data, object.contentType)
+	}
+
+	// Storing the same content again skips the upload
+	if _, err := store.Put(ctx, data, "application/vnd.cyclonedx+json"); err != nil {
+		t.Fatal(err)
+	}
+	if s.puts != 1 {
+		t.Fatalf("uploads = %d, want 1", s.puts)
+	}
+
+	got, err := store.Get(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Fatalf("Get = %s, want %s", got, data)
+	}
+
+	s.objects[key] = s3Object{data: []byte("tampered")}
+	if _, err := store.Get(ctx, ref); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("Get of tampered artifact: got %v, want %v", err, ErrDigestMismatch)
+	}
+}
+
+// TestS3StoreMinIO runs against the minio service of docker-compose.yml when
+// SBOMER_TEST_S3_ENDPOINT is set, e.g. to http://localhost:9000
+func TestS3StoreMinIO(t *testing.T) {
+	endpoint := os.Getenv("SBOMER_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("SBOMER_TEST_S3_ENDPOINT is not set")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	store, err := NewS3Store(ctx, S3Config{
+		Endpoint:  u.Host,
+		Region:    "us-east-1",
+		Bucket:    "sbomer",
+		Prefix:    "test",
+		AccessKey: "minioadmin",
+		SecretKey: "minioadmin",
+		UseSSL:    u.Scheme == "https",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(fmt.Sprintf(`{"test":%q}`, t.Name()+time.Now().String()))
+	ref, err := store.Put(ctx, data, "application/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Fatalf("Get = %s, want %s", got, data)
+	}
+}
@@ -0,0 +1,102 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionZstd identifies zstd-compressed blobs
+const CompressionZstd = "zstd"
+
+// encoder and decoder are shared, since zstd encoders and decoders are safe for
+// concurrent use of EncodeAll and DecodeAll and expensive to create
+var (
+	encoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	})
+	decoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil)
+	})
+)
+
+// Blob is a canonicalized, compressed JSON document addressed by its digest
+type Blob struct {
+	Digest         string
+	Compression    string
+	Size           int
+	CompressedData []byte
+}
+
+// New canonicalizes and compresses a JSON document
+func New(document []byte) (*Blob, error) {
+	canonical, err := Canonicalize(document)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := encoder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+
+	return &Blob{
+		Digest:         Digest(canonical),
+		Compression:    CompressionZstd,
+		Size:           len(canonical),
+		CompressedData: enc.EncodeAll(canonical, nil),
+	}, nil
+}
+
+// Digest returns the "sha256:<hex>" digest of a canonical document. Artifact references
+// hash the document as generated instead, so the two differ unless it is already canonical.
+func Digest(canonical []byte) string {
+	sum := sha256.Sum256(canonical)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Canonicalize re-encodes a JSON document compactly with sorted object keys, so that
+// documents differing only in formatting or key order share a digest
+func Canonicalize(document []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON document: %w", err)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, fmt.Errorf("failed to encode canonical JSON document: %w", err)
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Decompress returns the canonical document stored in compressed form
+func Decompress(compression string, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionZstd:
+		dec, err := decoder()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		document, err := dec.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress blob: %w", err)
+		}
+		return document, nil
+	case "", "none":
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported blob compression: %s", compression)
+	}
+}
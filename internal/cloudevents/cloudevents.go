@@ -0,0 +1,87 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SpecVersion is the CloudEvents specification version emitted by sbomer
+	SpecVersion = "1.0"
+
+	// ModeStructured carries the whole event, attributes included, in the message body
+	ModeStructured = "structured"
+	// ModeBinary carries the event data in the body and the attributes in message headers
+	ModeBinary = "binary"
+
+	// StructuredContentType is the content type of a structured mode JSON event
+	StructuredContentType = "application/cloudevents+json; charset=utf-8"
+
+	// headerPrefix is the AMQP application-properties prefix defined by the AMQP protocol binding
+	headerPrefix = "cloudEvents_"
+)
+
+// Event is a CloudEvents 1.0 event with JSON data
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// New creates an event with a random ID and the current time, marshaling data as JSON
+func New(source, eventType, subject string, data interface{}) (*Event, error) {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event data: %w", err)
+	}
+
+	return &Event{
+		SpecVersion:     SpecVersion,
+		ID:              uuid.NewString(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            dataBytes,
+	}, nil
+}
+
+// Structured encodes the event for structured content mode
+func (e *Event) Structured() ([]byte, string, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal cloud event: %w", err)
+	}
+	return body, StructuredContentType, nil
+}
+
+// Binary encodes the event for binary content mode, returning the body, its
+// content type and the attributes as AMQP headers
+func (e *Event) Binary() ([]byte, string, map[string]interface{}) {
+	headers := map[string]interface{}{
+		headerPrefix + "specversion": e.SpecVersion,
+		headerPrefix + "id":          e.ID,
+		headerPrefix + "source":      e.Source,
+		headerPrefix + "type":        e.Type,
+		headerPrefix + "time":        e.Time.Format(time.RFC3339Nano),
+	}
+	if e.Subject != "" {
+		headers[headerPrefix+"subject"] = e.Subject
+	}
+
+	return e.Data, e.DataContentType, headers
+}
+
+// ValidMode reports whether mode is a supported content mode
+func ValidMode(mode string) bool {
+	return mode == ModeStructured || mode == ModeBinary
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zcubbs/sbomer/internal/blob"
 	"github.com/zcubbs/sbomer/internal/models"
 )
 
@@ -29,75 +30,106 @@ func (db *DB) Close() {
 	}
 }
 
-func (db *DB) LogOperation(ctx context.Context, projectID int, operation string, status string, error string) error {
-	query := `
-		INSERT INTO operations (project_id, operation, status, error_message)
-		VALUES ($1, $2, $3, $4)
-	`
-	_, err := db.pool.Exec(ctx, query, projectID, operation, status, error)
-	if err != nil {
-		return fmt.Errorf("failed to log operation: %w", err)
+// Ping verifies that a connection to the database can be acquired
+func (db *DB) Ping(ctx context.Context) error {
+	if err := db.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
 	}
 	return nil
 }
 
-// SaveSBOM saves or updates an SBOM for a project
+// SaveSBOM saves or updates an SBOM for a project. The document is stored once per
+// digest in sbom_blobs and the project row points at it.
 func (db *DB) SaveSBOM(ctx context.Context, sbom *models.SBOM) error {
+	b, err := blob.New(sbom.SBOMData)
+	if err != nil {
+		return fmt.Errorf("failed to encode SBOM: %w", err)
+	}
+
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := saveBlob(ctx, tx, b); err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO sbom (
+			instance,
 			project_uid,
 			name,
 			path,
 			topics,
-			sbom_data,
+			sbom_digest,
 			updated_at
 		) VALUES (
-			$1, $2, $3, $4, $5, CURRENT_TIMESTAMP
+			$1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP
 		)
-		ON CONFLICT (project_uid) DO UPDATE SET
+		ON CONFLICT (instance, project_uid) DO UPDATE SET
 			name = EXCLUDED.name,
 			path = EXCLUDED.path,
 			topics = EXCLUDED.topics,
-			sbom_data = EXCLUDED.sbom_data,
+			sbom_digest = EXCLUDED.sbom_digest,
+			sbom_data = NULL,
 			updated_at = CURRENT_TIMESTAMP
 	`
 
-	_, err := db.pool.Exec(ctx, query,
+	_, err = tx.Exec(ctx, query,
+		sbom.Instance,
 		sbom.ProjectUID,
 		sbom.Name,
 		sbom.Path,
 		sbom.Topics,
-		sbom.SBOMData,
+		b.Digest,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to save SBOM: %w", err)
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit SBOM: %w", err)
+	}
+
+	sbom.SBOMDigest = b.Digest
 	return nil
 }
 
-// GetSBOM retrieves an SBOM by project UID
-func (db *DB) GetSBOM(ctx context.Context, projectUID int) (*models.SBOM, error) {
+// GetSBOM retrieves the SBOM of a project on a GitLab instance, rehydrating the document from its blob
+func (db *DB) GetSBOM(ctx context.Context, instance string, projectUID int) (*models.SBOM, error) {
 	query := `
 		SELECT
-			project_uid,
-			name,
-			path,
-			topics,
-			sbom_data,
-			created_at,
-			updated_at
-		FROM sbom
-		WHERE project_uid = $1
+			s.instance,
+			s.project_uid,
+			s.name,
+			s.path,
+			s.topics,
+			COALESCE(s.sbom_digest, ''),
+			s.sbom_data,
+			b.compression,
+			b.data,
+			s.created_at,
+			s.updated_at
+		FROM sbom s
+		LEFT JOIN sbom_blobs b ON b.digest = s.sbom_digest
+		WHERE s.instance = $1 AND s.project_uid = $2
 	`
 
 	sbom := &models.SBOM{}
-	err := db.pool.QueryRow(ctx, query, projectUID).Scan(
+	var compression *string
+	var blobData []byte
+	err := db.pool.QueryRow(ctx, query, instance, projectUID).Scan(
+		&sbom.Instance,
 		&sbom.ProjectUID,
 		&sbom.Name,
 		&sbom.Path,
 		&sbom.Topics,
+		&sbom.SBOMDigest,
 		&sbom.SBOMData,
+		&compression,
+		&blobData,
 		&sbom.CreatedAt,
 		&sbom.UpdatedAt,
 	)
@@ -108,5 +140,14 @@ func (db *DB) GetSBOM(ctx context.Context, projectUID int) (*models.SBOM, error)
 		return nil, fmt.Errorf("failed to get SBOM: %w", err)
 	}
 
+	// Rows saved before blob storage keep their document inline
+	if compression != nil {
+		document, err := blob.Decompress(*compression, blobData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rehydrate SBOM: %w", err)
+		}
+		sbom.SBOMData = document
+	}
+
 	return sbom, nil
 }
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zcubbs/sbomer/internal/db/models"
+)
+
+// StartFetchCycle resumes the latest running cycle of the instance and schedule, or
+// starts the given one if there is none. Running cycles started more than maxAge ago are
+// abandoned. It reports whether a cycle was resumed, in which case cycle is overwritten
+// with it.
+func (db *DB) StartFetchCycle(ctx context.Context, cycle *models.FetchCycle, maxAge time.Duration) (bool, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	abandon := `
+		UPDATE fetch_cycles SET
+			state = $3,
+			finished_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE instance = $1
+			AND schedule = $2
+			AND state = $4
+			AND started_at < CURRENT_TIMESTAMP - make_interval(secs => $5)`
+
+	if _, err := tx.Exec(ctx, abandon, cycle.Instance, cycle.Schedule, models.FetchCycleAbandoned, models.FetchCycleRunning, maxAge.Seconds()); err != nil {
+		return false, fmt.Errorf("failed to abandon stale fetch cycles: %w", err)
+	}
+
+	resume := `
+		UPDATE fetch_cycles SET
+			leader_id = NULLIF($4, ''),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM fetch_cycles
+			WHERE instance = $1 AND schedule = $2 AND state = $3
+			ORDER BY started_at DESC
+			LIMIT 1
+		)
+		RETURNING id::text, started_at`
+
+	resumed := true
+	err = tx.QueryRow(ctx, resume, cycle.Instance, cycle.Schedule, models.FetchCycleRunning, cycle.LeaderID).Scan(&cycle.ID, &cycle.StartedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		resumed = false
+		create := `
+			INSERT INTO fetch_cycles (
+				id,
+				instance,
+				schedule,
+				leader_id,
+				state
+			) VALUES (
+				$1, $2, $3, NULLIF($4, ''), $5
+			) RETURNING started_at`
+
+		err = tx.QueryRow(ctx, create, cycle.ID, cycle.Instance, cycle.Schedule, cycle.LeaderID, models.FetchCycleRunning).Scan(&cycle.StartedAt)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to start fetch cycle: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	cycle.State = models.FetchCycleRunning
+	return resumed, nil
+}
+
+// FinishFetchCycle marks a fetch cycle as completed
+func (db *DB) FinishFetchCycle(ctx context.Context, cycleID string) error {
+	query := `
+		UPDATE fetch_cycles SET
+			state = $2,
+			finished_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	if _, err := db.pool.Exec(ctx, query, cycleID, models.FetchCycleCompleted); err != nil {
+		return fmt.Errorf("failed to finish fetch cycle: %w", err)
+	}
+	return nil
+}
+
+// GetFetchCheckpoints returns the checkpoints of a fetch cycle by group ID
+func (db *DB) GetFetchCheckpoints(ctx context.Context, cycleID string) (map[string]*models.FetchCheckpoint, error) {
+	query := `
+		SELECT
+			cycle_id::text,
+			group_id,
+			page,
+			COALESCE(cursor, ''),
+			projects_count,
+			done
+		FROM fetch_checkpoints
+		WHERE cycle_id = $1`
+
+	rows, err := db.pool.Query(ctx, query, cycleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fetch checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	checkpoints := make(map[string]*models.FetchCheckpoint)
+	for rows.Next() {
+		checkpoint := &models.FetchCheckpoint{}
+		if err := rows.Scan(
+			&checkpoint.CycleID,
+			&checkpoint.GroupID,
+			&checkpoint.Page,
+			&checkpoint.Cursor,
+			&checkpoint.ProjectsCount,
+			&checkpoint.Done,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan fetch checkpoint: %w", err)
+		}
+		checkpoints[checkpoint.GroupID] = checkpoint
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get fetch checkpoints: %w", err)
+	}
+
+	return checkpoints, nil
+}
+
+// SaveFetchCheckpoint records the progress of a fetch cycle through a group
+func (db *DB) SaveFetchCheckpoint(ctx context.Context, checkpoint *models.FetchCheckpoint) error {
+	query := `
+		INSERT INTO fetch_checkpoints (
+			cycle_id,
+			group_id,
+			page,
+			cursor,
+			projects_count,
+			done,
+			updated_at
+		) VALUES (
+			$1, $2, $3, NULLIF($4, ''), $5, $6, CURRENT_TIMESTAMP
+		)
+		ON CONFLICT (cycle_id, group_id) DO UPDATE SET
+			page = EXCLUDED.page,
+			cursor = EXCLUDED.cursor,
+			projects_count = EXCLUDED.projects_count,
+			done = EXCLUDED.done,
+			updated_at = CURRENT_TIMESTAMP`
+
+	_, err := db.pool.Exec(ctx, query,
+		checkpoint.CycleID,
+		checkpoint.GroupID,
+		checkpoint.Page,
+		checkpoint.Cursor,
+		checkpoint.ProjectsCount,
+		checkpoint.Done,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save fetch checkpoint: %w", err)
+	}
+	return nil
+}
@@ -11,15 +11,23 @@ import (
 func (db *DB) SaveFetchStats(ctx context.Context, stats *models.FetchStats) error {
 	query := `
 		INSERT INTO fetch_stats (
+			instance,
+			cycle_id,
+			group_id,
+			leader_id,
 			projects_count,
 			batch_size,
 			duration_seconds,
 			created_at
 		) VALUES (
-			$1, $2, $3, $4
+			$1, NULLIF($2, '')::uuid, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8
 		) RETURNING id`
 
 	err := db.pool.QueryRow(ctx, query,
+		stats.Instance,
+		stats.CycleID,
+		stats.GroupID,
+		stats.LeaderID,
 		stats.ProjectsCount,
 		stats.BatchSize,
 		stats.Duration,
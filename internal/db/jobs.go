@@ -0,0 +1,284 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zcubbs/sbomer/internal/db/models"
+	"github.com/zcubbs/sbomer/internal/redact"
+)
+
+// CreateJob records a queued job
+func (db *DB) CreateJob(ctx context.Context, job *models.Job) error {
+	query := `
+		INSERT INTO jobs (
+			id,
+			instance,
+			project_id,
+			state
+		) VALUES (
+			$1, $2, $3, $4
+		) RETURNING queued_at`
+
+	err := db.pool.QueryRow(ctx, query,
+		job.ID,
+		job.Instance,
+		job.ProjectID,
+		models.JobQueued,
+	).Scan(&job.QueuedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+
+	job.State = models.JobQueued
+	return nil
+}
+
+// CreateJobUnlessPending records a queued job unless the project already has a pending
+// job queued within ttl. It reports whether the job was created. The check and insert
+// hold a transaction-scoped advisory lock on the project, so concurrent callers cannot
+// both find no pending job.
+func (db *DB) CreateJobUnlessPending(ctx context.Context, job *models.Job, ttl time.Duration) (bool, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	lockKey := LockKey(fmt.Sprintf("job:%s:%d", job.Instance, job.ProjectID))
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", lockKey); err != nil {
+		return false, fmt.Errorf("failed to lock project jobs: %w", err)
+	}
+
+	query := `
+		INSERT INTO jobs (
+			id,
+			instance,
+			project_id,
+			state
+		)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (
+			SELECT 1 FROM jobs
+			WHERE instance = $2
+				AND project_id = $3
+				AND state = ANY($5)
+				AND queued_at > CURRENT_TIMESTAMP - make_interval(secs => $6)
+		)
+		RETURNING queued_at`
+
+	err = tx.QueryRow(ctx, query,
+		job.ID,
+		job.Instance,
+		job.ProjectID,
+		models.JobQueued,
+		models.PendingStates,
+		ttl.Seconds(),
+	).Scan(&job.QueuedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	job.State = models.JobQueued
+	return true, nil
+}
+
+// StartJob records a processing attempt of a job by a worker, creating the job if it
+// was queued without one, and returns the number of attempts so far
+func (db *DB) StartJob(ctx context.Context, jobID string, instance string, projectID int, workerID string) (int, error) {
+	query := `
+		INSERT INTO jobs (
+			id,
+			instance,
+			project_id,
+			state,
+			attempts,
+			worker_id,
+			started_at
+		) VALUES (
+			$1, $2, $3, $4, 1, $5, CURRENT_TIMESTAMP
+		)
+		ON CONFLICT (id) DO UPDATE SET
+			attempts = jobs.attempts + 1,
+			worker_id = EXCLUDED.worker_id,
+			started_at = EXCLUDED.started_at,
+			failed_stage = NULL,
+			error_category = NULL,
+			error_message = NULL,
+			finished_at = NULL,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING attempts`
+
+	var attempts int
+	err := db.pool.QueryRow(ctx, query, jobID, instance, projectID, models.JobQueued, workerID).Scan(&attempts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start job: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// StartJobStage moves a job into a processing stage and records when the stage started
+func (db *DB) StartJobStage(ctx context.Context, jobID string, stage models.JobState) error {
+	if !stage.IsStage() {
+		return fmt.Errorf("invalid job stage: %s", stage)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE jobs SET
+			state = $2,
+			%s_started_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, stage)
+
+	if _, err := db.pool.Exec(ctx, query, jobID, stage); err != nil {
+		return fmt.Errorf("failed to start job stage: %w", err)
+	}
+	return nil
+}
+
+// FinishJobStage records how long a processing stage took
+func (db *DB) FinishJobStage(ctx context.Context, jobID string, stage models.JobState, duration time.Duration) error {
+	if !stage.IsStage() {
+		return fmt.Errorf("invalid job stage: %s", stage)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE jobs SET
+			%s_duration_ms = $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, stage)
+
+	if _, err := db.pool.Exec(ctx, query, jobID, duration.Milliseconds()); err != nil {
+		return fmt.Errorf("failed to finish job stage: %w", err)
+	}
+	return nil
+}
+
+// FinishJob moves a job into a terminal state
+func (db *DB) FinishJob(ctx context.Context, jobID string, state models.JobState) error {
+	if !state.IsTerminal() {
+		return fmt.Errorf("invalid terminal job state: %s", state)
+	}
+
+	query := `
+		UPDATE jobs SET
+			state = $2,
+			finished_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	if _, err := db.pool.Exec(ctx, query, jobID, state); err != nil {
+		return fmt.Errorf("failed to finish job: %w", err)
+	}
+	return nil
+}
+
+// FailJob marks a job as failed, recording the stage it failed in and the redacted error
+func (db *DB) FailJob(ctx context.Context, jobID string, stage models.JobState, category string, message string) error {
+	query := `
+		UPDATE jobs SET
+			state = $2,
+			failed_stage = NULLIF($3, ''),
+			error_category = $4,
+			error_message = $5,
+			finished_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	_, err := db.pool.Exec(ctx, query, jobID, models.JobFailed, stage, category, redact.String(message))
+	if err != nil {
+		return fmt.Errorf("failed to fail job: %w", err)
+	}
+	return nil
+}
+
+// RequeueJob returns a job that failed with a retryable error to the queued state,
+// keeping the error of the last attempt
+func (db *DB) RequeueJob(ctx context.Context, jobID string, stage models.JobState, category string, message string) error {
+	query := `
+		UPDATE jobs SET
+			state = $2,
+			failed_stage = NULLIF($3, ''),
+			error_category = $4,
+			error_message = $5,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	_, err := db.pool.Exec(ctx, query, jobID, models.JobQueued, stage, category, redact.String(message))
+	if err != nil {
+		return fmt.Errorf("failed to requeue job: %w", err)
+	}
+	return nil
+}
+
+// SetJobCommit records the ref and commit a job scans
+func (db *DB) SetJobCommit(ctx context.Context, jobID string, ref string, commitSHA string) error {
+	query := `
+		UPDATE jobs SET
+			ref = $2,
+			commit_sha = $3,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	if _, err := db.pool.Exec(ctx, query, jobID, ref, commitSHA); err != nil {
+		return fmt.Errorf("failed to set job commit: %w", err)
+	}
+	return nil
+}
+
+// FindSupersedingJob returns the ID of a job queued after the given one for the same
+// project, ref and commit that is being processed or done, or "" if there is none
+func (db *DB) FindSupersedingJob(ctx context.Context, jobID string) (string, error) {
+	query := `
+		SELECT newer.id::text
+		FROM jobs job
+		JOIN jobs newer
+			ON newer.instance = job.instance
+			AND newer.project_id = job.project_id
+			AND newer.ref = job.ref
+			AND newer.commit_sha = job.commit_sha
+			AND newer.id <> job.id
+			AND newer.queued_at > job.queued_at
+		WHERE job.id = $1
+			AND newer.state = ANY($2)
+		ORDER BY newer.queued_at DESC
+		LIMIT 1`
+
+	states := []models.JobState{models.JobCloning, models.JobGenerating, models.JobStoring, models.JobPublishing, models.JobDone}
+
+	var newerID string
+	if err := db.pool.QueryRow(ctx, query, jobID, states).Scan(&newerID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to find superseding job: %w", err)
+	}
+	return newerID, nil
+}
+
+// SkipJob marks a job as skipped because a newer job covers the same commit
+func (db *DB) SkipJob(ctx context.Context, jobID string, supersededBy string) error {
+	query := `
+		UPDATE jobs SET
+			state = $2,
+			superseded_by = $3,
+			finished_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	if _, err := db.pool.Exec(ctx, query, jobID, models.JobSkipped, supersededBy); err != nil {
+		return fmt.Errorf("failed to skip job: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AdvisoryLock is a session-level Postgres advisory lock. It is held on a dedicated
+// connection and released by Postgres when that connection is closed.
+type AdvisoryLock struct {
+	conn *pgxpool.Conn
+	key  int64
+}
+
+// LockKey derives the advisory lock key of a lock name
+func LockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// TryAdvisoryLock takes the advisory lock key without waiting. It returns nil if the
+// lock is held by another session.
+func (db *DB) TryAdvisoryLock(ctx context.Context, key int64) (*AdvisoryLock, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	var locked bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+	if !locked {
+		conn.Release()
+		return nil, nil
+	}
+
+	return &AdvisoryLock{conn: conn, key: key}, nil
+}
+
+// Check verifies that the lock is still held by its session
+func (l *AdvisoryLock) Check(ctx context.Context) error {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_locks
+			WHERE locktype = 'advisory'
+				AND pid = pg_backend_pid()
+				AND granted
+				AND objsubid = 1
+				AND ((classid::bigint << 32) | objid::bigint) = $1
+		)`
+
+	var held bool
+	if err := l.conn.QueryRow(ctx, query, l.key).Scan(&held); err != nil {
+		return fmt.Errorf("failed to check advisory lock: %w", err)
+	}
+	if !held {
+		return fmt.Errorf("advisory lock %d is no longer held", l.key)
+	}
+	return nil
+}
+
+// Release unlocks the lock and returns its connection to the pool. The connection is
+// closed instead if unlocking fails, which releases the lock as well.
+func (l *AdvisoryLock) Release(ctx context.Context) error {
+	defer l.conn.Release()
+
+	if _, err := l.conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		_ = l.conn.Conn().Close(ctx)
+		return fmt.Errorf("failed to release advisory lock: %w", err)
+	}
+	return nil
+}
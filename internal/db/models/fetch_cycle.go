@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// FetchCycleState is the lifecycle state of a fetch cycle
+type FetchCycleState string
+
+const (
+	FetchCycleRunning   FetchCycleState = "running"
+	FetchCycleCompleted FetchCycleState = "completed"
+	FetchCycleAbandoned FetchCycleState = "abandoned"
+)
+
+// FetchCycle is one logical pass over the projects of a GitLab instance. A cycle that
+// is interrupted stays running and is resumed by the next run.
+type FetchCycle struct {
+	ID         string          `db:"id"`
+	Instance   string          `db:"instance"`
+	Schedule   string          `db:"schedule"`
+	LeaderID   string          `db:"leader_id"`
+	State      FetchCycleState `db:"state"`
+	StartedAt  time.Time       `db:"started_at"`
+	FinishedAt *time.Time      `db:"finished_at"`
+}
+
+// FetchCheckpoint records how far a fetch cycle got through a group or project ID range
+type FetchCheckpoint struct {
+	CycleID string `db:"cycle_id"`
+	// GroupID is a project ID range, e.g. projects:0-5000, when no groups are set
+	GroupID string `db:"group_id"`
+	// Page is the next page of an offset-paginated listing
+	Page int `db:"page"`
+	// Cursor is the link to the next page of a keyset-paginated listing
+	Cursor        string `db:"cursor"`
+	ProjectsCount int    `db:"projects_count"`
+	Done          bool   `db:"done"`
+}
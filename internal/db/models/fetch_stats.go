@@ -7,6 +7,10 @@ import (
 // FetchStats represents statistics from GitLab project fetches
 type FetchStats struct {
 	ID            int64     `db:"id"`
+	Instance      string    `db:"instance"`
+	CycleID       string    `db:"cycle_id"`
+	GroupID       string    `db:"group_id"`
+	LeaderID      string    `db:"leader_id"`
 	ProjectsCount int       `db:"projects_count"`
 	BatchSize     int       `db:"batch_size"`
 	Duration      float64   `db:"duration_seconds"`
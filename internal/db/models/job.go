@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+)
+
+// JobState is the lifecycle state of a job
+type JobState string
+
+const (
+	JobQueued     JobState = "queued"
+	JobCloning    JobState = "cloning"
+	JobGenerating JobState = "generating"
+	JobStoring    JobState = "storing"
+	JobPublishing JobState = "publishing"
+	JobDone       JobState = "done"
+	JobFailed     JobState = "failed"
+	JobSkipped    JobState = "skipped"
+
+	// JobEnqueuing is the failed stage of a job whose message the fetcher could not
+	// publish to the work queue; jobs are never in it
+	JobEnqueuing JobState = "enqueuing"
+)
+
+// IsStage reports whether the state is a processing stage with its own timestamps
+func (s JobState) IsStage() bool {
+	switch s {
+	case JobCloning, JobGenerating, JobStoring, JobPublishing:
+		return true
+	}
+	return false
+}
+
+// PendingStates are the states of jobs that are queued or being processed
+var PendingStates = []JobState{JobQueued, JobCloning, JobGenerating, JobStoring, JobPublishing}
+
+// IsTerminal reports whether the job has finished
+func (s JobState) IsTerminal() bool {
+	return s == JobDone || s == JobFailed || s == JobSkipped
+}
+
+// Job tracks the processing of one project from publish to completion
+type Job struct {
+	ID            string     `db:"id"`
+	Instance      string     `db:"instance"`
+	ProjectID     int        `db:"project_id"`
+	State         JobState   `db:"state"`
+	Ref           string     `db:"ref"`
+	CommitSHA     string     `db:"commit_sha"`
+	SupersededBy  string     `db:"superseded_by"`
+	Attempts      int        `db:"attempts"`
+	WorkerID      string     `db:"worker_id"`
+	FailedStage   string     `db:"failed_stage"`
+	ErrorCategory string     `db:"error_category"`
+	ErrorMessage  string     `db:"error_message"`
+	QueuedAt      time.Time  `db:"queued_at"`
+	StartedAt     *time.Time `db:"started_at"`
+	FinishedAt    *time.Time `db:"finished_at"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Filter decisions recorded for listed projects. Projects skipped by a filter record
+// its reason, as counted by metrics.ProjectsFiltered.
+const (
+	DecisionPublished     = "published"
+	DecisionPublishFailed = "publish_failed"
+	DecisionPendingJob    = "pending_job"
+	DecisionOtherSchedule = "other_schedule"
+	// DecisionOutOfScope marks a project that is no longer listed but still exists, such
+	// as one moved to a group no cycle fetches
+	DecisionOutOfScope = "out_of_scope"
+)
+
+// Project holds the ownership and metadata of a GitLab project. The JSONB columns are
+// NULL when they could not be looked up, in which case saving keeps their last value.
+type Project struct {
+	Instance       string     `db:"instance"`
+	ProjectID      int        `db:"project_id"`
+	Name           string     `db:"name"`
+	Path           string     `db:"path"`
+	Namespace      string     `db:"namespace"`
+	Visibility     string     `db:"visibility"`
+	DefaultBranch  string     `db:"default_branch"`
+	Topics         []string   `db:"topics"`
+	LastActivityAt *time.Time `db:"last_activity_at"`
+
+	Maintainers      json.RawMessage    `db:"maintainers"`
+	CodeOwners       json.RawMessage    `db:"code_owners"`
+	Languages        map[string]float32 `db:"languages"`
+	CustomAttributes map[string]string  `db:"custom_attributes"`
+
+	// Archived to LastSeenAt are set by the fetcher for every project it lists.
+	// GroupID is the group the project was listed under, empty when all projects of
+	// the instance are listed.
+	Archived       bool       `db:"archived"`
+	FilterDecision string     `db:"filter_decision"`
+	Schedule       string     `db:"schedule"`
+	GroupID        string     `db:"group_id"`
+	LastSeenAt     *time.Time `db:"last_seen_at"`
+	// DeletedAt is set when a fetch cycle covering the project no longer lists it
+	DeletedAt *time.Time `db:"deleted_at"`
+
+	EnrichedAt *time.Time `db:"enriched_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+	UpdatedAt  time.Time  `db:"updated_at"`
+}
+
+// ProjectCoverage counts the projects of an instance by whether they have an SBOM.
+// Projects are in scope when the fetcher last published them or found them queued.
+type ProjectCoverage struct {
+	Instance string
+	// Projects, Archived, InScope and Filtered count projects not marked deleted
+	Projects int
+	Archived int
+	InScope  int
+	Filtered int
+	// Covered and Missing split InScope by whether an SBOM is stored
+	Covered int
+	Missing int
+	Deleted int
+	// OrphanedSBOMs are stored for projects marked deleted
+	OrphanedSBOMs int
+}
@@ -0,0 +1,343 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zcubbs/sbomer/internal/db/models"
+)
+
+// SaveProject saves or updates the ownership and metadata of a processed project.
+// Ownership columns that are nil keep their previous value.
+func (db *DB) SaveProject(ctx context.Context, project *models.Project) error {
+	query := `
+		INSERT INTO projects (
+			instance,
+			project_id,
+			name,
+			path,
+			namespace,
+			visibility,
+			default_branch,
+			topics,
+			last_activity_at,
+			maintainers,
+			code_owners,
+			languages,
+			custom_attributes,
+			enriched_at,
+			updated_at
+		) VALUES (
+			$1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, $9, $10, $11, $12, $13,
+			CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+		)
+		ON CONFLICT (instance, project_id) DO UPDATE SET
+			name = EXCLUDED.name,
+			path = EXCLUDED.path,
+			namespace = EXCLUDED.namespace,
+			visibility = EXCLUDED.visibility,
+			default_branch = EXCLUDED.default_branch,
+			topics = EXCLUDED.topics,
+			last_activity_at = EXCLUDED.last_activity_at,
+			maintainers = COALESCE(EXCLUDED.maintainers, projects.maintainers),
+			code_owners = COALESCE(EXCLUDED.code_owners, projects.code_owners),
+			languages = COALESCE(EXCLUDED.languages, projects.languages),
+			custom_attributes = COALESCE(EXCLUDED.custom_attributes, projects.custom_attributes),
+			enriched_at = CURRENT_TIMESTAMP,
+			deleted_at = NULL,
+			updated_at = CURRENT_TIMESTAMP`
+
+	topics := project.Topics
+	if topics == nil {
+		topics = []string{}
+	}
+
+	_, err := db.pool.Exec(ctx, query,
+		project.Instance,
+		project.ProjectID,
+		project.Name,
+		project.Path,
+		project.Namespace,
+		project.Visibility,
+		project.DefaultBranch,
+		topics,
+		project.LastActivityAt,
+		project.Maintainers,
+		project.CodeOwners,
+		project.Languages,
+		project.CustomAttributes,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save project: %w", err)
+	}
+	return nil
+}
+
+// SaveListedProjects records the projects listed by a fetch cycle, marking them as seen
+// now. Projects left to another schedule keep the filter decision and schedule of the
+// schedule that fetches them.
+func (db *DB) SaveListedProjects(ctx context.Context, projects []*models.Project) error {
+	query := `
+		INSERT INTO projects (
+			instance,
+			project_id,
+			name,
+			path,
+			namespace,
+			visibility,
+			default_branch,
+			topics,
+			last_activity_at,
+			archived,
+			filter_decision,
+			schedule,
+			group_id,
+			last_seen_at,
+			updated_at
+		) VALUES (
+			$1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, $9, $10, $11, $12,
+			NULLIF($13, ''), CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+		)
+		ON CONFLICT (instance, project_id) DO UPDATE SET
+			name = EXCLUDED.name,
+			path = EXCLUDED.path,
+			namespace = EXCLUDED.namespace,
+			visibility = EXCLUDED.visibility,
+			default_branch = EXCLUDED.default_branch,
+			topics = EXCLUDED.topics,
+			last_activity_at = EXCLUDED.last_activity_at,
+			archived = EXCLUDED.archived,
+			filter_decision = CASE WHEN EXCLUDED.filter_decision = $14
+				THEN COALESCE(projects.filter_decision, EXCLUDED.filter_decision)
+				ELSE EXCLUDED.filter_decision END,
+			schedule = CASE WHEN EXCLUDED.filter_decision = $14
+				THEN COALESCE(projects.schedule, EXCLUDED.schedule)
+				ELSE EXCLUDED.schedule END,
+			group_id = EXCLUDED.group_id,
+			last_seen_at = CURRENT_TIMESTAMP,
+			deleted_at = NULL,
+			updated_at = CURRENT_TIMESTAMP`
+
+	batch := &pgx.Batch{}
+	for _, project := range projects {
+		topics := project.Topics
+		if topics == nil {
+			topics = []string{}
+		}
+		batch.Queue(query,
+			project.Instance,
+			project.ProjectID,
+			project.Name,
+			project.Path,
+			project.Namespace,
+			project.Visibility,
+			project.DefaultBranch,
+			topics,
+			project.LastActivityAt,
+			project.Archived,
+			project.FilterDecision,
+			project.Schedule,
+			project.GroupID,
+			models.DecisionOtherSchedule,
+		)
+	}
+
+	results := db.pool.SendBatch(ctx, batch)
+	for range projects {
+		if _, err := results.Exec(); err != nil {
+			results.Close()
+			return fmt.Errorf("failed to save listed project: %w", err)
+		}
+	}
+	if err := results.Close(); err != nil {
+		return fmt.Errorf("failed to save listed projects: %w", err)
+	}
+	return nil
+}
+
+// ListUnlistedProjects returns the IDs of the projects of an instance that a completed
+// fetch cycle did not list and that are not marked deleted yet. groupIDs restricts this
+// to the projects last listed under those groups; nil covers every project of the
+// instance. Projects listed by any cycle since the cycle started are left out.
+func (db *DB) ListUnlistedProjects(ctx context.Context, instance string, cycleID string, groupIDs []string) ([]int, error) {
+	query := `
+		SELECT project_id
+		FROM projects
+		WHERE instance = $1
+			AND deleted_at IS NULL
+			AND last_seen_at < (SELECT started_at FROM fetch_cycles WHERE id = $2)
+			AND ($3::text[] IS NULL OR group_id = ANY($3))
+		ORDER BY project_id`
+
+	rows, err := db.pool.Query(ctx, query, instance, cycleID, groupIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unlisted projects: %w", err)
+	}
+	defer rows.Close()
+
+	var projectIDs []int
+	for rows.Next() {
+		var projectID int
+		if err := rows.Scan(&projectID); err != nil {
+			return nil, fmt.Errorf("failed to scan unlisted project: %w", err)
+		}
+		projectIDs = append(projectIDs, projectID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list unlisted projects: %w", err)
+	}
+
+	return projectIDs, nil
+}
+
+// MarkDeletedProjects marks projects of an instance as deleted
+func (db *DB) MarkDeletedProjects(ctx context.Context, instance string, projectIDs []int) (int64, error) {
+	query := `
+		UPDATE projects SET
+			deleted_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE instance = $1
+			AND project_id = ANY($2)
+			AND deleted_at IS NULL`
+
+	tag, err := db.pool.Exec(ctx, query, instance, projectIDs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark deleted projects: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// MarkOutOfScopeProjects records that projects of an instance still exist although no
+// cycle lists them
+func (db *DB) MarkOutOfScopeProjects(ctx context.Context, instance string, projectIDs []int) error {
+	query := `
+		UPDATE projects SET
+			filter_decision = $3,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE instance = $1
+			AND project_id = ANY($2)
+			AND deleted_at IS NULL`
+
+	if _, err := db.pool.Exec(ctx, query, instance, projectIDs, models.DecisionOutOfScope); err != nil {
+		return fmt.Errorf("failed to mark out of scope projects: %w", err)
+	}
+	return nil
+}
+
+// GetProjectCoverage counts the projects of each instance by whether they have an SBOM
+func (db *DB) GetProjectCoverage(ctx context.Context) ([]*models.ProjectCoverage, error) {
+	query := `
+		SELECT
+			instance,
+			COUNT(*) FILTER (WHERE deleted_at IS NULL),
+			COUNT(*) FILTER (WHERE deleted_at IS NULL AND archived),
+			COUNT(*) FILTER (WHERE deleted_at IS NULL AND in_scope),
+			COUNT(*) FILTER (WHERE deleted_at IS NULL AND NOT in_scope),
+			COUNT(*) FILTER (WHERE deleted_at IS NULL AND in_scope AND has_sbom),
+			COUNT(*) FILTER (WHERE deleted_at IS NULL AND in_scope AND NOT has_sbom),
+			COUNT(*) FILTER (WHERE deleted_at IS NOT NULL),
+			COUNT(*) FILTER (WHERE deleted_at IS NOT NULL AND has_sbom)
+		FROM (
+			-- Projects saved by the processor but not listed by any cycle yet have no
+			-- decision; they were queued, so they count as in scope
+			SELECT
+				p.instance,
+				p.deleted_at,
+				p.archived,
+				p.filter_decision IS NULL OR p.filter_decision = ANY($1) AS in_scope,
+				s.project_uid IS NOT NULL AS has_sbom
+			FROM projects p
+			LEFT JOIN sbom s ON s.instance = p.instance AND s.project_uid = p.project_id
+		) AS coverage
+		GROUP BY instance
+		ORDER BY instance`
+
+	inScope := []string{models.DecisionPublished, models.DecisionPublishFailed, models.DecisionPendingJob}
+	rows, err := db.pool.Query(ctx, query, inScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var coverage []*models.ProjectCoverage
+	for rows.Next() {
+		c := &models.ProjectCoverage{}
+		if err := rows.Scan(
+			&c.Instance,
+			&c.Projects,
+			&c.Archived,
+			&c.InScope,
+			&c.Filtered,
+			&c.Covered,
+			&c.Missing,
+			&c.Deleted,
+			&c.OrphanedSBOMs,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan project coverage: %w", err)
+		}
+		coverage = append(coverage, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get project coverage: %w", err)
+	}
+
+	return coverage, nil
+}
+
+// CountOrphanedSBOMs counts the SBOMs of projects marked deleted before deletedBefore
+func (db *DB) CountOrphanedSBOMs(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM sbom s
+		JOIN projects p ON p.instance = s.instance AND p.project_id = s.project_uid
+		WHERE p.deleted_at < $1`
+
+	var count int64
+	if err := db.pool.QueryRow(ctx, query, deletedBefore).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count orphaned SBOMs: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteOrphanedSBOMs deletes the SBOMs of projects marked deleted before deletedBefore,
+// along with the blobs no other SBOM references
+func (db *DB) DeleteOrphanedSBOMs(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		DELETE FROM sbom s
+		USING projects p
+		WHERE p.instance = s.instance
+			AND p.project_id = s.project_uid
+			AND p.deleted_at < $1
+		RETURNING s.sbom_digest`
+
+	rows, err := tx.Query(ctx, query, deletedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete orphaned SBOMs: %w", err)
+	}
+	digests, err := pgx.CollectRows(rows, pgx.RowTo[*string])
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete orphaned SBOMs: %w", err)
+	}
+
+	blobs := `
+		DELETE FROM sbom_blobs b
+		WHERE b.digest = ANY($1)
+			AND NOT EXISTS (SELECT 1 FROM sbom s WHERE s.sbom_digest = b.digest)`
+
+	if _, err := tx.Exec(ctx, blobs, digests); err != nil {
+		return 0, fmt.Errorf("failed to delete orphaned SBOM blobs: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int64(len(digests)), nil
+}
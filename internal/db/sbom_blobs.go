@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zcubbs/sbomer/internal/blob"
+)
+
+// saveBlob stores a blob unless a blob with the same digest already exists
+func saveBlob(ctx context.Context, tx pgx.Tx, b *blob.Blob) error {
+	query := `
+		INSERT INTO sbom_blobs (
+			digest,
+			compression,
+			size_bytes,
+			data
+		) VALUES (
+			$1, $2, $3, $4
+		)
+		ON CONFLICT (digest) DO NOTHING
+	`
+
+	_, err := tx.Exec(ctx, query, b.Digest, b.Compression, b.Size, b.CompressedData)
+	if err != nil {
+		return fmt.Errorf("failed to save SBOM blob: %w", err)
+	}
+
+	return nil
+}
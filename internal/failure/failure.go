@@ -0,0 +1,119 @@
+package failure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// Category classifies why an operation failed
+type Category string
+
+const (
+	CategoryUnknown         Category = "unknown"
+	CategoryEmptyRepository Category = "empty_repository"
+	CategoryAuth            Category = "auth"
+	CategoryNotFound        Category = "not_found"
+	CategoryNetwork         Category = "network"
+	CategoryRateLimited     Category = "rate_limited"
+	CategoryTimeout         Category = "timeout"
+	CategoryCanceled        Category = "canceled"
+	CategoryDiskFull        Category = "disk_full"
+	CategoryMalformedInput  Category = "malformed_input"
+	CategoryTooLarge        Category = "too_large"
+	CategoryToolCrash       Category = "tool_crash"
+	CategoryConfiguration   Category = "configuration"
+	CategoryStorage         Category = "storage"
+	CategoryQueue           Category = "queue"
+)
+
+// Retryable reports whether an operation failing with this category may succeed if retried
+func (c Category) Retryable() bool {
+	switch c {
+	case CategoryNetwork, CategoryRateLimited, CategoryTimeout, CategoryCanceled, CategoryDiskFull,
+		CategoryToolCrash, CategoryStorage, CategoryQueue:
+		return true
+	default:
+		return false
+	}
+}
+
+// MaxAttempts bounds the attempts of an operation failing with this category to limit.
+// Unclassified failures are as often deterministic as not, so they are retried once.
+func (c Category) MaxAttempts(limit int) int {
+	switch {
+	case c == CategoryUnknown:
+		return min(limit, 2)
+	case c.Retryable():
+		return limit
+	default:
+		return 1
+	}
+}
+
+// Error is an error with a failure category
+type Error struct {
+	Category Category
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New wraps err with a category
+func New(category Category, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Category: category, Err: err}
+}
+
+// Newf formats an error with a category
+func Newf(category Category, format string, args ...interface{}) error {
+	return &Error{Category: category, Err: fmt.Errorf(format, args...)}
+}
+
+// CategoryOf returns the category of the outermost categorized error in err's chain,
+// falling back to well-known standard library errors
+func CategoryOf(err error) Category {
+	if err == nil {
+		return ""
+	}
+
+	var categorized *Error
+	if errors.As(err, &categorized) {
+		return categorized.Category
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CategoryTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return CategoryCanceled
+	}
+	if errors.Is(err, syscall.ENOSPC) {
+		return CategoryDiskFull
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return CategoryTimeout
+		}
+		return CategoryNetwork
+	}
+
+	return CategoryUnknown
+}
+
+// IsRetryable reports whether err may succeed if retried
+func IsRetryable(err error) bool {
+	return err != nil && CategoryOf(err).Retryable()
+}
@@ -0,0 +1,271 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zcubbs/sbomer/internal/db/models"
+	"github.com/zcubbs/sbomer/internal/logging"
+	"github.com/zcubbs/sbomer/internal/metrics"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxResumeAge bounds how old an interrupted cycle may be to be resumed rather than
+// abandoned
+const maxResumeAge = 24 * time.Hour
+
+// shardPrefix marks the checkpoints of project ID ranges listed when no groups are set
+const shardPrefix = "projects:"
+
+// cycle is a run of a fetch cycle, which may resume an interrupted one
+type cycle struct {
+	id        string
+	settings  *Settings
+	scope     scope
+	startTime time.Time
+
+	// mu guards stats and checkpoints, which concurrent fetches update
+	mu          sync.Mutex
+	stats       cycleStats
+	checkpoints map[string]*models.FetchCheckpoint
+}
+
+// cycleStats counts the projects handled during one fetch cycle
+type cycleStats struct {
+	listed       int
+	filtered     int
+	deduplicated int
+	published    int
+}
+
+// startCycle resumes the interrupted cycle of the instance and schedule, if any, or
+// starts a new one
+func (s *Service) startCycle(ctx context.Context, settings *Settings, sc scope) (*cycle, error) {
+	record := &models.FetchCycle{
+		ID:       uuid.NewString(),
+		Instance: s.instance,
+		Schedule: sc.name,
+		LeaderID: s.leaderID(),
+	}
+	resumed, err := s.db.StartFetchCycle(ctx, record, maxResumeAge)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints, err := s.db.GetFetchCheckpoints(ctx, record.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if resumed {
+		s.logger.Info("resuming interrupted fetch cycle",
+			slog.String("cycle_id", record.ID),
+			slog.String("schedule", sc.name),
+			slog.Time("started_at", record.StartedAt),
+			slog.Int("checkpoints", len(checkpoints)),
+		)
+	}
+
+	return &cycle{
+		id:          record.ID,
+		settings:    settings,
+		scope:       sc,
+		startTime:   time.Now(),
+		checkpoints: checkpoints,
+	}, nil
+}
+
+// concurrency returns how many groups or shards the cycle fetches at a time
+func (c *cycle) concurrency() int {
+	return max(c.settings.Concurrency, 1)
+}
+
+// checkpoint returns the progress of the cycle through a group or project ID range
+func (c *cycle) checkpoint(groupID string) *models.FetchCheckpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	checkpoint, ok := c.checkpoints[groupID]
+	if !ok {
+		checkpoint = &models.FetchCheckpoint{CycleID: c.id, GroupID: groupID}
+		c.checkpoints[groupID] = checkpoint
+	}
+	return checkpoint
+}
+
+// addStats adds the counts of one group to the cycle totals
+func (c *cycle) addStats(stats *cycleStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.listed += stats.listed
+	c.stats.filtered += stats.filtered
+	c.stats.deduplicated += stats.deduplicated
+	c.stats.published += stats.published
+}
+
+// saveProgress records fetch statistics and the checkpoint after a batch was published
+func (s *Service) saveProgress(ctx context.Context, c *cycle, checkpoint *models.FetchCheckpoint) {
+	fetchStats := &models.FetchStats{
+		Instance:      s.instance,
+		CycleID:       c.id,
+		GroupID:       checkpoint.GroupID,
+		LeaderID:      s.leaderID(),
+		ProjectsCount: checkpoint.ProjectsCount,
+		BatchSize:     c.settings.BatchSize,
+		Duration:      time.Since(c.startTime).Seconds(),
+		CreatedAt:     time.Now(),
+	}
+	if err := s.db.SaveFetchStats(ctx, fetchStats); err != nil {
+		s.logger.Warn("failed to save fetch stats", logging.Err(err))
+	}
+
+	if err := s.db.SaveFetchCheckpoint(ctx, checkpoint); err != nil {
+		s.logger.Warn("failed to save fetch checkpoint", slog.String("group_id", checkpoint.GroupID), logging.Err(err))
+	}
+}
+
+// fetchFunc lists and publishes the projects of a group or project ID range
+type fetchFunc func(ctx context.Context, c *cycle, key string, stats *cycleStats) (int, error)
+
+// fetchConcurrently runs fetch for every key, at most c.concurrency() at a time. A key
+// that fails is logged and counted without stopping the others. All fetches go through
+// the instance's GitLab client and so share its rate limiter.
+func (s *Service) fetchConcurrently(ctx context.Context, c *cycle, keys []string, fetch fetchFunc) (totalProjects, failed int) {
+	var (
+		mu sync.Mutex
+		g  errgroup.Group
+	)
+	g.SetLimit(c.concurrency())
+
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			break
+		}
+
+		g.Go(func() error {
+			var stats cycleStats
+			startTime := time.Now()
+			count, err := fetch(ctx, c, key, &stats)
+			duration := time.Since(startTime)
+			c.addStats(&stats)
+
+			result := "completed"
+			switch {
+			case ctx.Err() != nil:
+				result = "interrupted"
+			case err != nil:
+				result = "failed"
+			}
+			metrics.GroupFetches.WithLabelValues(s.instance, result).Inc()
+			metrics.GroupFetchDuration.WithLabelValues(s.instance).Observe(duration.Seconds())
+
+			logger := s.logger.With(slog.String("group_id", key))
+			switch result {
+			case "failed":
+				logger.Error("error fetching group", logging.Operation("fetch"), logging.Err(err))
+			case "completed":
+				// Shard bounds move with every new project, so only groups get gauges
+				if !strings.HasPrefix(key, shardPrefix) {
+					metrics.LastCycleGroupProjects.WithLabelValues(s.instance, key, "listed").Set(float64(stats.listed))
+					metrics.LastCycleGroupProjects.WithLabelValues(s.instance, key, "filtered").Set(float64(stats.filtered))
+					metrics.LastCycleGroupProjects.WithLabelValues(s.instance, key, "deduplicated").Set(float64(stats.deduplicated))
+					metrics.LastCycleGroupProjects.WithLabelValues(s.instance, key, "published").Set(float64(stats.published))
+				}
+				logger.Info("fetched group",
+					logging.Operation("fetch"),
+					slog.Int("projects", count),
+					slog.Int("filtered", stats.filtered),
+					slog.Int("deduplicated", stats.deduplicated),
+					slog.Int("published", stats.published),
+					logging.Duration(duration),
+				)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			totalProjects += count
+			if result == "failed" {
+				failed++
+			}
+			return nil
+		})
+	}
+
+	_ = g.Wait()
+	return totalProjects, failed
+}
+
+// projectShards splits the project IDs of the instance into one range per concurrent
+// fetch. A resumed cycle keeps the ranges it started with so that its checkpoints apply.
+func (s *Service) projectShards(ctx context.Context, c *cycle) ([]string, error) {
+	var shards []string
+	for key := range c.checkpoints {
+		if strings.HasPrefix(key, shardPrefix) {
+			shards = append(shards, key)
+		}
+	}
+	if len(shards) > 0 {
+		slices.SortFunc(shards, func(a, b string) int {
+			afterA, _, _ := parseShard(a)
+			afterB, _, _ := parseShard(b)
+			return afterA - afterB
+		})
+		return shards, nil
+	}
+
+	// The newest project bounds the ranges; projects created later fall into the last one
+	projects, _, err := s.gitlabClient.Projects.ListProjects(&gitlab.ListProjectsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 1},
+		OrderBy:     gitlab.Ptr("id"),
+		Sort:        gitlab.Ptr("desc"),
+		Simple:      gitlab.Ptr(true),
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the newest project: %w", err)
+	}
+
+	count := c.concurrency()
+	if len(projects) == 0 || projects[0].ID < count {
+		count = 1
+	}
+	step := 0
+	if count > 1 {
+		step = projects[0].ID/count + 1
+	}
+
+	// Record every range up front so that a resumed cycle finds all of them
+	for i := range count {
+		before := (i+1)*step + 1
+		if i == count-1 {
+			before = 0
+		}
+		shard := formatShard(i*step, before)
+		if err := s.db.SaveFetchCheckpoint(ctx, c.checkpoint(shard)); err != nil {
+			return nil, err
+		}
+		shards = append(shards, shard)
+	}
+	return shards, nil
+}
+
+// formatShard names the range of project IDs above after and below before; a before of
+// zero leaves the range open
+func formatShard(after, before int) string {
+	return fmt.Sprintf("%s%d-%d", shardPrefix, after, before)
+}
+
+// parseShard returns the bounds of a range named by formatShard
+func parseShard(shard string) (after, before int, err error) {
+	if _, err := fmt.Sscanf(strings.TrimPrefix(shard, shardPrefix), "%d-%d", &after, &before); err != nil {
+		return 0, 0, fmt.Errorf("invalid project range %q: %w", shard, err)
+	}
+	return after, before, nil
+}
@@ -4,85 +4,162 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/robfig/cron/v3"
 	"github.com/zcubbs/sbomer/internal/db"
 	"github.com/zcubbs/sbomer/internal/db/models"
+	"github.com/zcubbs/sbomer/internal/failure"
+	gl "github.com/zcubbs/sbomer/internal/gitlab"
+	"github.com/zcubbs/sbomer/internal/leader"
+	"github.com/zcubbs/sbomer/internal/logging"
+	"github.com/zcubbs/sbomer/internal/metrics"
+	"github.com/zcubbs/sbomer/internal/rabbitmq"
+	"github.com/zcubbs/sbomer/internal/tracing"
 	gitlab "gitlab.com/gitlab-org/api/client-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Service struct {
-	gitlabClient  *gitlab.Client
-	publisher     Publisher
-	db            *db.DB
-	schedule      string
-	batchSize     int
-	coolOffSecs   int
-	groupIDs      []string
-	excludeTopics []string
-	includeTopics []string
-	cron          *cron.Cron
+	instance     string
+	gitlabClient *gitlab.Client
+	publisher    Publisher
+	db           *db.DB
+	cron         *cron.Cron
+	elector      *leader.Elector
+	logger       *slog.Logger
+
+	// settings are swapped as a whole by Update; each cycle works on the settings
+	// it started with
+	settings atomic.Pointer[Settings]
+
+	// mu guards cronEntries and running
+	mu          sync.Mutex
+	cronEntries []cron.EntryID
+	// running holds the schedules with a cycle in progress, so that a tick firing
+	// before the previous cycle of its schedule finished does not start a second one
+	running map[string]bool
+}
+
+// Settings are the fetcher settings that can change while it is running
+type Settings struct {
+	Schedule      string
+	BatchSize     int
+	CoolOffSecs   int
+	GroupIDs      []string
+	ExcludeTopics []string
+	IncludeTopics []string
+	// GroupIDs may hold full paths and glob patterns as well as IDs. AllGroups adds the
+	// top-level groups the token can see; ExcludeGroups are patterns of groups whose
+	// projects, subgroups included, are skipped.
+	AllGroups     bool
+	ExcludeGroups []string
+	// DedupTTLSecs skips projects with a pending job queued within this many seconds;
+	// zero publishes every project
+	DedupTTLSecs int
+	// Concurrency bounds how many groups, or project ID ranges without groups, are
+	// fetched at a time
+	Concurrency int
+	// Priority is the message priority of projects fetched on Schedule
+	Priority uint8
+	// Schedules fetch some groups or topics on schedules of their own
+	Schedules []Schedule
 }
 
 type Publisher interface {
-	Publish(ctx context.Context, body []byte) error
+	PublishMessage(ctx context.Context, msg rabbitmq.Message) error
 }
 
 type Config struct {
-	GitLabToken   string
+	// Instance names the GitLab instance the service fetches from
+	Instance      string
+	GitLabToken   *gl.Token
 	GitLabURL     string
 	Schedule      string
 	BatchSize     int
 	CoolOffSecs   int
 	GroupIDs      []string
+	AllGroups     bool
+	ExcludeGroups []string
 	ExcludeTopics []string
 	IncludeTopics []string
+	DedupTTLSecs  int
+	Concurrency   int
+	Priority      uint8
+	Schedules     []Schedule
 	Publisher     Publisher
 	DB            *db.DB
+	Logger        *slog.Logger
+
+	// RateLimit paces and retries GitLab API requests
+	RateLimit gl.RateLimit
+	// Elector restricts fetch cycles to the leader among replicas; nil runs every cycle
+	Elector *leader.Elector
 }
 
 func New(config Config) (*Service, error) {
 	// Initialize GitLab client
-	gitlabClient, err := gitlab.NewClient(config.GitLabToken, gitlab.WithBaseURL(config.GitLabURL))
+	gitlabClient, err := gl.NewAPIClient(gl.APIConfig{
+		Token:     config.GitLabToken,
+		BaseURL:   config.GitLabURL,
+		RateLimit: config.RateLimit,
+		Logger:    config.Logger,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GitLab client: %w", err)
 	}
 
-	return &Service{
-		gitlabClient:  gitlabClient,
-		publisher:     config.Publisher,
-		db:            config.DB,
-		schedule:      config.Schedule,
-		batchSize:     config.BatchSize,
-		coolOffSecs:   config.CoolOffSecs,
-		groupIDs:      config.GroupIDs,
-		excludeTopics: config.ExcludeTopics,
-		includeTopics: config.IncludeTopics,
-		cron:          cron.New(cron.WithSeconds()),
-	}, nil
+	service := &Service{
+		instance:     config.Instance,
+		gitlabClient: gitlabClient,
+		publisher:    config.Publisher,
+		db:           config.DB,
+		cron:         cron.New(cron.WithSeconds()),
+		elector:      config.Elector,
+		logger:       logging.Component(config.Logger, "fetcher").With(logging.Instance(config.Instance)),
+		running:      make(map[string]bool),
+	}
+	service.settings.Store(&Settings{
+		Schedule:      config.Schedule,
+		BatchSize:     config.BatchSize,
+		CoolOffSecs:   config.CoolOffSecs,
+		DedupTTLSecs:  config.DedupTTLSecs,
+		Concurrency:   config.Concurrency,
+		Priority:      config.Priority,
+		Schedules:     config.Schedules,
+		GroupIDs:      config.GroupIDs,
+		AllGroups:     config.AllGroups,
+		ExcludeGroups: config.ExcludeGroups,
+		ExcludeTopics: config.ExcludeTopics,
+		IncludeTopics: config.IncludeTopics,
+	})
+
+	return service, nil
 }
 
 func (s *Service) Start(ctx context.Context) error {
-	// Special case for "once" schedule
-	if s.schedule == "once" {
-		fmt.Printf("Running fetch and publish job once at %v\n", time.Now())
-		if err := s.fetchAndPublish(ctx); err != nil {
-			return fmt.Errorf("error in fetch and publish: %w", err)
+	settings := s.settings.Load()
+
+	// Special case for "once" schedule, which runs every schedule once
+	if settings.Schedule == "once" {
+		s.logger.Info("running fetch and publish job once")
+		for _, name := range scheduleNames(settings) {
+			if err := s.runCycle(ctx, name); err != nil {
+				return fmt.Errorf("error in fetch and publish of schedule %q: %w", name, err)
+			}
 		}
 		return nil
 	}
 
-	// Regular cron schedule
-	_, err := s.cron.AddFunc(s.schedule, func() {
-		fmt.Printf("Running fetch and publish job at %v\n", time.Now())
-		if err := s.fetchAndPublish(ctx); err != nil {
-			log.Printf("Error in fetch and publish: %v", err)
-		}
-	})
-	if err != nil {
-		return fmt.Errorf("failed to add cron job: %w", err)
+	// Regular cron schedules
+	if err := s.schedule(ctx, settings); err != nil {
+		return err
 	}
 
 	// Start the cron scheduler
@@ -90,51 +167,289 @@ func (s *Service) Start(ctx context.Context) error {
 	return nil
 }
 
+// Update replaces the settings of a running service. Cycles in progress finish with
+// the settings they started with; changed schedules take effect immediately.
+func (s *Service) Update(ctx context.Context, settings Settings) error {
+	current := s.settings.Load()
+
+	changes := diffSettings(current, &settings)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	switch {
+	case current.Schedule == "once" || settings.Schedule == "once":
+		if settings.Schedule != current.Schedule {
+			return fmt.Errorf("cannot switch schedule between %q and %q without a restart", current.Schedule, settings.Schedule)
+		}
+	case settings.Schedule != current.Schedule || !reflect.DeepEqual(settings.Schedules, current.Schedules):
+		if err := s.schedule(ctx, &settings); err != nil {
+			return err
+		}
+	}
+
+	s.settings.Store(&settings)
+	for _, change := range changes {
+		s.logger.Info("updated fetcher setting",
+			slog.String("setting", change.name),
+			slog.Any("old", change.old),
+			slog.Any("new", change.new),
+		)
+	}
+	return nil
+}
+
+// settingChange is a setting that differs between two Settings
+type settingChange struct {
+	name     string
+	old, new interface{}
+}
+
+// diffSettings lists the settings that differ between old and new
+func diffSettings(old, new *Settings) []settingChange {
+	var changes []settingChange
+	add := func(name string, o, n interface{}) {
+		if !reflect.DeepEqual(o, n) {
+			changes = append(changes, settingChange{name: name, old: o, new: n})
+		}
+	}
+
+	add("schedule", old.Schedule, new.Schedule)
+	add("batch_size", old.BatchSize, new.BatchSize)
+	add("cool_off_secs", old.CoolOffSecs, new.CoolOffSecs)
+	add("group_ids", old.GroupIDs, new.GroupIDs)
+	add("all_groups", old.AllGroups, new.AllGroups)
+	add("exclude_groups", old.ExcludeGroups, new.ExcludeGroups)
+	add("exclude_topics", old.ExcludeTopics, new.ExcludeTopics)
+	add("include_topics", old.IncludeTopics, new.IncludeTopics)
+	add("dedup_ttl_secs", old.DedupTTLSecs, new.DedupTTLSecs)
+	add("concurrency", old.Concurrency, new.Concurrency)
+	add("priority", old.Priority, new.Priority)
+	add("schedules", old.Schedules, new.Schedules)
+	return changes
+}
+
+// Ping verifies that the GitLab API is reachable
+func (s *Service) Ping(ctx context.Context) error {
+	return gl.PingAPI(ctx, s.gitlabClient)
+}
+
 func (s *Service) Stop() {
 	if s.cron != nil {
 		s.cron.Stop()
 	}
 }
 
-func (s *Service) fetchAndPublish(ctx context.Context) error {
-	log.Printf("Starting fetch and publish cycle")
-	startTime := time.Now()
-	totalProjects := 0
-
-	if len(s.groupIDs) > 0 {
-		// Fetch projects from specified groups
-		for _, groupID := range s.groupIDs {
-			projectCount, err := s.fetchGroupProjects(ctx, groupID, startTime)
-			if err != nil {
-				log.Printf("Error fetching projects for group %s: %v", groupID, err)
-				continue
-			}
-			totalProjects += projectCount
+// runCycle runs a fetch cycle of the named schedule if this replica is the leader. The
+// cycle is canceled when leadership is lost.
+func (s *Service) runCycle(ctx context.Context, name string) error {
+	if !s.startRunning(name) {
+		s.logger.Warn("skipping fetch cycle, the previous cycle is still running", slog.String("schedule", name))
+		return nil
+	}
+	defer s.stopRunning(name)
+
+	if s.elector != nil {
+		leaderCtx, cancel, ok := s.elector.Lead(ctx)
+		if !ok {
+			s.logger.Info("skipping fetch cycle, another replica is the leader")
+			metrics.SkippedCycles.Inc()
+			return nil
 		}
+		defer cancel()
+		ctx = leaderCtx
+	}
+	return s.fetchAndPublish(ctx, name)
+}
+
+// startRunning marks a cycle of the named schedule as running, or reports false if one is
+func (s *Service) startRunning(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running[name] {
+		return false
+	}
+	s.running[name] = true
+	return true
+}
+
+func (s *Service) stopRunning(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, name)
+}
+
+// leaderID returns the identity recorded with fetch statistics
+func (s *Service) leaderID() string {
+	if s.elector == nil {
+		return ""
+	}
+	return s.elector.ID()
+}
+
+func (s *Service) fetchAndPublish(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "fetch cycle", trace.WithAttributes(
+		attribute.String("sbomer.instance", s.instance),
+		attribute.String("sbomer.schedule", name),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	settings := s.settings.Load()
+	sc, ok := settings.scope(name)
+	if !ok {
+		s.logger.Info("skipping fetch cycle of a removed schedule", slog.String("schedule", name))
+		return nil
+	}
+	if err := s.resolveScope(ctx, &sc); err != nil {
+		metrics.FetchCycles.WithLabelValues("failed").Inc()
+		return fmt.Errorf("failed to resolve groups: %w", err)
+	}
+	if len(sc.groups) == 0 && !sc.allProjects {
+		s.logger.Info("skipping fetch cycle, no groups left to fetch", slog.String("schedule", name))
+		return nil
+	}
+
+	c, err := s.startCycle(ctx, settings, sc)
+	if err != nil {
+		metrics.FetchCycles.WithLabelValues("failed").Inc()
+		return err
+	}
+	span.SetAttributes(attribute.String("sbomer.cycle.id", c.id))
+	logger := s.logger.With(slog.String("cycle_id", c.id), slog.String("schedule", name))
+
+	logger.Info("starting fetch and publish cycle", logging.Operation("fetch"), slog.Int("concurrency", c.concurrency()))
+	var totalProjects, failed int
+
+	if !sc.allProjects {
+		// Fetch projects from specified groups; a failing group does not fail the cycle
+		totalProjects, failed = s.fetchConcurrently(ctx, c, sc.groups, s.fetchGroupProjects)
 	} else {
-		// Fetch all projects
-		projectCount, err := s.fetchAllProjects(ctx, startTime)
+		// Fetch all projects, split into ID ranges listed side by side
+		shards, err := s.projectShards(ctx, c)
 		if err != nil {
+			metrics.FetchCycles.WithLabelValues("failed").Inc()
 			return fmt.Errorf("error fetching all projects: %w", err)
 		}
-		totalProjects = projectCount
+		totalProjects, failed = s.fetchConcurrently(ctx, c, shards, s.fetchShardProjects)
+		if failed > 0 && ctx.Err() == nil {
+			// Leave the cycle running so that the next run retries the failed shards
+			metrics.FetchCycles.WithLabelValues("failed").Inc()
+			return fmt.Errorf("error fetching all projects: %d of %d shards failed", failed, len(shards))
+		}
+	}
+
+	// Leave the cycle running so that the next run resumes it
+	if ctx.Err() != nil {
+		metrics.FetchCycles.WithLabelValues("interrupted").Inc()
+		return fmt.Errorf("fetch cycle interrupted: %w", ctx.Err())
 	}
 
-	log.Printf("Completed fetch and publish cycle. Processed %d projects in %.2f seconds", totalProjects, time.Since(startTime).Seconds())
+	if err := s.db.FinishFetchCycle(ctx, c.id); err != nil {
+		logger.Warn("failed to record fetch cycle completion", logging.Err(err))
+	}
+	s.markDeletedProjects(ctx, c, logger)
+
+	duration := time.Since(c.startTime)
+	metrics.FetchCycles.WithLabelValues("completed").Inc()
+	metrics.FetchCycleDuration.Observe(duration.Seconds())
+	metrics.LastCycleProjects.WithLabelValues(s.instance, name, "listed").Set(float64(c.stats.listed))
+	metrics.LastCycleProjects.WithLabelValues(s.instance, name, "filtered").Set(float64(c.stats.filtered))
+	metrics.LastCycleProjects.WithLabelValues(s.instance, name, "deduplicated").Set(float64(c.stats.deduplicated))
+	metrics.LastCycleProjects.WithLabelValues(s.instance, name, "published").Set(float64(c.stats.published))
+
+	logger.Info("completed fetch and publish cycle",
+		logging.Operation("fetch"),
+		slog.Int("projects", totalProjects),
+		slog.Int("filtered", c.stats.filtered),
+		slog.Int("deduplicated", c.stats.deduplicated),
+		slog.Int("published", c.stats.published),
+		slog.Int("failed_groups", failed),
+		logging.Duration(duration),
+	)
 	return nil
 }
 
-func (s *Service) shouldProcessProject(project *gitlab.Project) bool {
-	if len(s.excludeTopics) == 0 {
+// publishBatch filters a page of projects listed under key by topic, publishes the
+// remaining ones and records every project with the decision taken in the inventory
+func (s *Service) publishBatch(ctx context.Context, c *cycle, key string, projects []*gitlab.Project, stats *cycleStats) {
+	stats.listed += len(projects)
+	metrics.ProjectsListed.Add(float64(len(projects)))
+
+	inventory := make([]*models.Project, 0, len(projects))
+	for _, project := range projects {
+		decision := s.handleProject(ctx, c, project, stats)
+		inventory = append(inventory, s.inventoryRecord(c, key, project, decision))
+	}
+
+	if err := s.db.SaveListedProjects(ctx, inventory); err != nil {
+		s.logger.Warn("failed to save listed projects", slog.String("group_id", key), logging.Err(err))
+	}
+}
+
+// handleProject filters and publishes a listed project, returning the decision taken
+func (s *Service) handleProject(ctx context.Context, c *cycle, project *gitlab.Project, stats *cycleStats) string {
+	settings := c.settings
+
+	// Skip if project is fetched on another schedule
+	if ok, reason := c.scope.claims(project); !ok {
+		stats.filtered++
+		metrics.ProjectsFiltered.WithLabelValues(reason).Inc()
+		// The schedule that fetches the project records its decision
+		if reason != metrics.FilterExcludedGroup {
+			return models.DecisionOtherSchedule
+		}
+		return reason
+	}
+
+	// Skip if project has excluded topics
+	if !s.shouldProcessProject(settings, project) {
+		stats.filtered++
+		metrics.ProjectsFiltered.WithLabelValues(metrics.FilterExcludedTopic).Inc()
+		return metrics.FilterExcludedTopic
+	}
+
+	// Skip if project does not include specified topics; include_topics only filters
+	// projects listed from groups
+	if !c.scope.allProjects && !s.projectIncludesTopics(settings, project) {
+		stats.filtered++
+		metrics.ProjectsFiltered.WithLabelValues(metrics.FilterMissingTopic).Inc()
+		return metrics.FilterMissingTopic
+	}
+
+	published, err := s.publishProject(ctx, c, project.ID)
+	if err != nil {
+		metrics.PublishErrors.Inc()
+		s.logger.Error("failed to publish project", logging.ProjectID(project.ID), logging.Operation("publish"), logging.Err(err))
+		return models.DecisionPublishFailed
+	}
+
+	// Skip if a previous cycle's job for the project is still pending
+	if !published {
+		stats.deduplicated++
+		metrics.ProjectsFiltered.WithLabelValues(metrics.FilterPendingJob).Inc()
+		s.logger.Debug("skipping project with a pending job", logging.ProjectID(project.ID))
+		return models.DecisionPendingJob
+	}
+	stats.published++
+	metrics.ProjectsPublished.Inc()
+	return models.DecisionPublished
+}
+
+func (s *Service) shouldProcessProject(settings *Settings, project *gitlab.Project) bool {
+	if len(settings.ExcludeTopics) == 0 {
 		return true
 	}
 
 	// Check if any of the project's topics match the excluded topics
 	for _, topic := range project.Topics {
-		for _, excludedTopic := range s.excludeTopics {
+		for _, excludedTopic := range settings.ExcludeTopics {
 			if topic == excludedTopic {
-				log.Printf("Skipping project %s (ID: %d) due to excluded topic: %s",
-					project.PathWithNamespace, project.ID, topic)
+				s.logger.Debug("skipping project with excluded topic",
+					logging.ProjectID(project.ID),
+					slog.String("path", project.PathWithNamespace),
+					slog.String("topic", topic),
+				)
 				return false
 			}
 		}
@@ -143,17 +458,20 @@ func (s *Service) shouldProcessProject(project *gitlab.Project) bool {
 	return true
 }
 
-func (s *Service) projectIncludesTopics(project *gitlab.Project) bool {
-	if len(s.includeTopics) == 0 {
+func (s *Service) projectIncludesTopics(settings *Settings, project *gitlab.Project) bool {
+	if len(settings.IncludeTopics) == 0 {
 		return true
 	}
 
 	// Check if any of the project's topics match the included topics
 	for _, topic := range project.Topics {
-		for _, includedTopic := range s.includeTopics {
+		for _, includedTopic := range settings.IncludeTopics {
 			if topic == includedTopic {
-				log.Printf("🔍 Find project with topic [%s] ➡️  %s",
-					topic, project.PathWithNamespace)
+				s.logger.Debug("found project with included topic",
+					logging.ProjectID(project.ID),
+					slog.String("path", project.PathWithNamespace),
+					slog.String("topic", topic),
+				)
 				return true
 			}
 		}
@@ -162,21 +480,34 @@ func (s *Service) projectIncludesTopics(project *gitlab.Project) bool {
 	return false
 }
 
-func (s *Service) fetchGroupProjects(ctx context.Context, groupID string, startTime time.Time) (int, error) {
-	totalProjects := 0
-	page := 1
+func (s *Service) fetchGroupProjects(ctx context.Context, c *cycle, groupID string, stats *cycleStats) (totalProjects int, err error) {
+	ctx, span := tracing.Start(ctx, "fetch group", trace.WithAttributes(attribute.String("sbomer.group.id", groupID)))
+	defer func() { tracing.End(span, err) }()
+
+	checkpoint := c.checkpoint(groupID)
+	if checkpoint.Done {
+		s.logger.Debug("skipping group fetched earlier in this cycle", slog.String("group_id", groupID))
+		return checkpoint.ProjectsCount, nil
+	}
+
+	// Continue from the page after the last one published
+	totalProjects = checkpoint.ProjectsCount
+	page := max(checkpoint.Page, 1)
+	if checkpoint.Page > 1 {
+		s.logger.Info("resuming group", slog.String("group_id", groupID), slog.Int("page", page))
+	}
 
 	for {
 		// List projects in the group with pagination
 		opt := &gitlab.ListGroupProjectsOptions{
 			ListOptions: gitlab.ListOptions{
 				Page:    page,
-				PerPage: s.batchSize,
+				PerPage: c.settings.BatchSize,
 			},
 			IncludeSubGroups: gitlab.Bool(true), // Include projects from subgroups
 		}
 
-		projects, resp, err := s.gitlabClient.Groups.ListGroupProjects(groupID, opt)
+		projects, resp, err := s.gitlabClient.Groups.ListGroupProjects(groupID, opt, gitlab.WithContext(ctx))
 		if err != nil {
 			return totalProjects, fmt.Errorf("failed to list group projects: %w", err)
 		}
@@ -185,36 +516,20 @@ func (s *Service) fetchGroupProjects(ctx context.Context, groupID string, startT
 		totalProjects += batchCount
 
 		// Process each project in the batch
-		for _, project := range projects {
-			// Skip if project has excluded topics
-			if !s.shouldProcessProject(project) {
-				continue
-			}
+		s.publishBatch(ctx, c, groupID, projects, stats)
 
-			// Skip if project does not include specified topics
-			if !s.projectIncludesTopics(project) {
-				continue
-			}
-
-			if err := s.publishProject(ctx, project.ID); err != nil {
-				log.Printf("Error publishing project %d: %v", project.ID, err)
-				continue
-			}
+		// A batch cut short is published again when the cycle is resumed
+		if ctx.Err() != nil {
+			return totalProjects, ctx.Err()
 		}
 
-		// Save fetch statistics for this batch
-		stats := &models.FetchStats{
-			ProjectsCount: totalProjects,
-			BatchSize:     s.batchSize,
-			Duration:      time.Since(startTime).Seconds(),
-			CreatedAt:     time.Now(),
-		}
-		if err := s.db.SaveFetchStats(ctx, stats); err != nil {
-			log.Printf("Error saving fetch stats: %v", err)
-		}
+		checkpoint.Page = resp.NextPage
+		checkpoint.ProjectsCount = totalProjects
+		checkpoint.Done = resp.NextPage == 0
+		s.saveProgress(ctx, c, checkpoint)
 
 		// Check if we've processed all pages
-		if resp.NextPage == 0 {
+		if checkpoint.Done {
 			break
 		}
 
@@ -225,27 +540,54 @@ func (s *Service) fetchGroupProjects(ctx context.Context, groupID string, startT
 		select {
 		case <-ctx.Done():
 			return totalProjects, ctx.Err()
-		case <-time.After(time.Duration(s.coolOffSecs) * time.Second):
+		case <-time.After(time.Duration(c.settings.CoolOffSecs) * time.Second):
 		}
 	}
 
 	return totalProjects, nil
 }
 
-func (s *Service) fetchAllProjects(ctx context.Context, startTime time.Time) (int, error) {
-	totalProjects := 0
-	page := 1
+// fetchShardProjects lists the projects of an ID range with keyset pagination, which
+// stays consistent while projects are created or deleted and can be resumed from a link
+func (s *Service) fetchShardProjects(ctx context.Context, c *cycle, shard string, stats *cycleStats) (totalProjects int, err error) {
+	ctx, span := tracing.Start(ctx, "fetch shard", trace.WithAttributes(attribute.String("sbomer.shard", shard)))
+	defer func() { tracing.End(span, err) }()
+
+	idAfter, idBefore, err := parseShard(shard)
+	if err != nil {
+		return 0, err
+	}
+
+	checkpoint := c.checkpoint(shard)
+	if checkpoint.Done {
+		return checkpoint.ProjectsCount, nil
+	}
+
+	totalProjects = checkpoint.ProjectsCount
+	if checkpoint.Cursor != "" {
+		s.logger.Info("resuming project listing", slog.String("shard", shard), slog.Int("projects", totalProjects))
+	}
 
 	for {
-		// List all projects with pagination
+		// List the projects of the shard ordered by ID
 		opt := &gitlab.ListProjectsOptions{
 			ListOptions: gitlab.ListOptions{
-				Page:    page,
-				PerPage: s.batchSize,
+				Pagination: "keyset",
+				PerPage:    c.settings.BatchSize,
 			},
+			OrderBy: gitlab.Ptr("id"),
+			Sort:    gitlab.Ptr("asc"),
+			IDAfter: gitlab.Ptr(idAfter),
+		}
+		if idBefore > 0 {
+			opt.IDBefore = gitlab.Ptr(idBefore)
+		}
+		options := []gitlab.RequestOptionFunc{gitlab.WithContext(ctx)}
+		if checkpoint.Cursor != "" {
+			options = append(options, gitlab.WithKeysetPaginationParameters(checkpoint.Cursor))
 		}
 
-		projects, resp, err := s.gitlabClient.Projects.ListProjects(opt)
+		projects, resp, err := s.gitlabClient.Projects.ListProjects(opt, options...)
 		if err != nil {
 			return totalProjects, fmt.Errorf("failed to list projects: %w", err)
 		}
@@ -254,65 +596,77 @@ func (s *Service) fetchAllProjects(ctx context.Context, startTime time.Time) (in
 		totalProjects += batchCount
 
 		// Process each project in the batch
-		for _, project := range projects {
-			// Skip if project has excluded topics
-			if !s.shouldProcessProject(project) {
-				continue
-			}
+		s.publishBatch(ctx, c, shard, projects, stats)
 
-			if err := s.publishProject(ctx, project.ID); err != nil {
-				log.Printf("Error publishing project %d: %v", project.ID, err)
-				continue
-			}
+		// A batch cut short is published again when the cycle is resumed
+		if ctx.Err() != nil {
+			return totalProjects, ctx.Err()
 		}
 
-		// Save fetch statistics for this batch
-		stats := &models.FetchStats{
-			ProjectsCount: totalProjects,
-			BatchSize:     s.batchSize,
-			Duration:      time.Since(startTime).Seconds(),
-			CreatedAt:     time.Now(),
-		}
-		if err := s.db.SaveFetchStats(ctx, stats); err != nil {
-			log.Printf("Error saving fetch stats: %v", err)
-		}
+		checkpoint.Cursor = resp.NextLink
+		checkpoint.ProjectsCount = totalProjects
+		checkpoint.Done = resp.NextLink == ""
+		s.saveProgress(ctx, c, checkpoint)
 
 		// Check if we've processed all pages
-		if resp.NextPage == 0 {
+		if checkpoint.Done {
 			break
 		}
 
-		// Move to next page
-		page = resp.NextPage
-
 		// Cool off between batches
 		select {
 		case <-ctx.Done():
 			return totalProjects, ctx.Err()
-		case <-time.After(time.Duration(s.coolOffSecs) * time.Second):
+		case <-time.After(time.Duration(c.settings.CoolOffSecs) * time.Second):
 		}
 	}
 
 	return totalProjects, nil
 }
 
-func (s *Service) publishProject(ctx context.Context, projectID int) error {
+// publishProject records a job for the project and publishes it with the priority of the
+// cycle's schedule. It reports false without publishing if the project already has a
+// pending job within the dedup TTL.
+func (s *Service) publishProject(ctx context.Context, c *cycle, projectID int) (bool, error) {
+	settings := c.settings
+	// Record the job before publishing so the processor can track its lifecycle
+	job := &models.Job{
+		ID:        uuid.NewString(),
+		Instance:  s.instance,
+		ProjectID: projectID,
+	}
+	if settings.DedupTTLSecs > 0 {
+		created, err := s.db.CreateJobUnlessPending(ctx, job, time.Duration(settings.DedupTTLSecs)*time.Second)
+		if err != nil || !created {
+			return false, err
+		}
+	} else if err := s.db.CreateJob(ctx, job); err != nil {
+		return false, err
+	}
+
 	message := struct {
-		ProjectID int `json:"project_id"`
+		Instance  string `json:"instance"`
+		ProjectID int    `json:"project_id"`
+		JobID     string `json:"job_id"`
 	}{
+		Instance:  s.instance,
 		ProjectID: projectID,
+		JobID:     job.ID,
 	}
 
 	// Marshal message to JSON
 	messageBytes, err := json.Marshal(message)
 	if err != nil {
-		return fmt.Errorf("error marshaling message: %w", err)
+		return false, fmt.Errorf("error marshaling message: %w", err)
 	}
 
 	// Publish message
-	if err := s.publisher.Publish(ctx, messageBytes); err != nil {
-		return fmt.Errorf("error publishing message: %w", err)
+	if err := s.publisher.PublishMessage(ctx, rabbitmq.Message{Body: messageBytes, Priority: c.scope.priority}); err != nil {
+		if failErr := s.db.FailJob(ctx, job.ID, models.JobEnqueuing, string(failure.CategoryQueue), err.Error()); failErr != nil {
+			s.logger.Warn("failed to record job failure", logging.JobID(job.ID), logging.Err(failErr))
+		}
+		return false, fmt.Errorf("error publishing message: %w", err)
 	}
 
-	return nil
+	return true, nil
 }
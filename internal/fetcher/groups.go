@@ -0,0 +1,166 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// isGroupPattern reports whether a group entry is a glob pattern rather than an ID or path
+func isGroupPattern(entry string) bool {
+	return strings.ContainsAny(entry, "*?[")
+}
+
+// isGroupID reports whether a group entry is a numeric group ID
+func isGroupID(entry string) bool {
+	_, err := strconv.Atoi(entry)
+	return err == nil
+}
+
+// inGroups reports whether a namespace, or one of its parent groups, matches one of the
+// patterns
+func inGroups(fullPath string, patterns []string) bool {
+	for p := fullPath; p != "" && p != "." && p != "/"; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, p); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveScope expands the group patterns of a scope into the groups its cycle fetches.
+// Group IDs and paths are fetched as given; patterns are matched against the full paths
+// of the groups the token can see. Groups excluded or fetched on other schedules are
+// dropped, as are groups below another fetched group, whose projects are listed with it.
+func (s *Service) resolveScope(ctx context.Context, sc *scope) error {
+	var entries []string
+	if sc.allGroups {
+		groups, err := s.listGroups(ctx, "", true)
+		if err != nil {
+			return fmt.Errorf("failed to list top-level groups: %w", err)
+		}
+		for _, group := range groups {
+			entries = append(entries, group.FullPath)
+		}
+	}
+	for _, entry := range sc.groupIDs {
+		if !isGroupPattern(entry) {
+			entries = append(entries, entry)
+			continue
+		}
+		matches, err := s.matchGroups(ctx, entry)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			s.logger.Warn("group pattern matches no groups", slog.String("pattern", entry))
+		}
+		entries = append(entries, matches...)
+	}
+
+	// Projects of claimed groups are filtered by path, so claimed IDs are looked up
+	claimedEntries := sc.claimedGroups
+	var claimed []string
+	for _, entry := range claimedEntries {
+		if !isGroupID(entry) {
+			claimed = append(claimed, entry)
+			continue
+		}
+		group, _, err := s.gitlabClient.Groups.GetGroup(entry, &gitlab.GetGroupOptions{WithProjects: gitlab.Ptr(false)}, gitlab.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to get group %s: %w", entry, err)
+		}
+		claimed = append(claimed, group.FullPath)
+	}
+	sc.claimedGroups = claimed
+
+	sc.groups = nil
+	for _, entry := range entries {
+		if slices.Contains(sc.groups, entry) || slices.Contains(claimedEntries, entry) {
+			continue
+		}
+		if !isGroupID(entry) {
+			if inGroups(entry, sc.excludedGroups) || inGroups(entry, sc.claimedGroups) {
+				continue
+			}
+			if parent := path.Dir(entry); parent != "." && inGroups(parent, entries) {
+				continue
+			}
+		}
+		sc.groups = append(sc.groups, entry)
+	}
+	return nil
+}
+
+// matchGroups returns the full paths of the groups matching a pattern. Only the groups
+// below the pattern's literal prefix are listed.
+func (s *Service) matchGroups(ctx context.Context, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid group pattern %q: %w", pattern, err)
+	}
+
+	var parent []string
+	for _, segment := range strings.Split(pattern, "/") {
+		if isGroupPattern(segment) {
+			break
+		}
+		parent = append(parent, segment)
+	}
+
+	groups, err := s.listGroups(ctx, strings.Join(parent, "/"), !strings.Contains(pattern, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups matching %q: %w", pattern, err)
+	}
+
+	var matches []string
+	for _, group := range groups {
+		if matched, _ := path.Match(pattern, group.FullPath); matched {
+			matches = append(matches, group.FullPath)
+		}
+	}
+	return matches, nil
+}
+
+// listGroups lists the descendants of parent, or without a parent all groups the token
+// can see, or only the top-level ones
+func (s *Service) listGroups(ctx context.Context, parent string, topLevelOnly bool) ([]*gitlab.Group, error) {
+	opt := &gitlab.ListGroupsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100, Page: 1},
+		OrderBy:     gitlab.Ptr("id"),
+	}
+	if parent == "" && topLevelOnly {
+		opt.TopLevelOnly = gitlab.Ptr(true)
+	}
+
+	var all []*gitlab.Group
+	for {
+		var (
+			groups []*gitlab.Group
+			resp   *gitlab.Response
+			err    error
+		)
+		if parent != "" {
+			descendantOpt := gitlab.ListDescendantGroupsOptions(*opt)
+			groups, resp, err = s.gitlabClient.Groups.ListDescendantGroups(parent, &descendantOpt, gitlab.WithContext(ctx))
+		} else {
+			groups, resp, err = s.gitlabClient.Groups.ListGroups(opt, gitlab.WithContext(ctx))
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, groups...)
+
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,103 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/zcubbs/sbomer/internal/db/models"
+	"github.com/zcubbs/sbomer/internal/logging"
+	"github.com/zcubbs/sbomer/internal/metrics"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// inventoryRecord returns the inventory row of a project listed under key with the
+// decision the cycle took on it
+func (s *Service) inventoryRecord(c *cycle, key string, project *gitlab.Project, decision string) *models.Project {
+	record := &models.Project{
+		Instance:       s.instance,
+		ProjectID:      project.ID,
+		Name:           project.Name,
+		Path:           project.PathWithNamespace,
+		Visibility:     string(project.Visibility),
+		DefaultBranch:  project.DefaultBranch,
+		Topics:         project.Topics,
+		LastActivityAt: project.LastActivityAt,
+		Archived:       project.Archived,
+		FilterDecision: decision,
+		Schedule:       c.scope.name,
+	}
+	if project.Namespace != nil {
+		record.Namespace = project.Namespace.FullPath
+	}
+	// Projects listed by ID range belong to no group
+	if !strings.HasPrefix(key, shardPrefix) {
+		record.GroupID = key
+	}
+	return record
+}
+
+// markDeletedProjects marks the projects the cycle no longer listed as deleted. Only
+// groups fetched completely count; without groups the cycle covers the whole instance.
+// Each project is looked up first, since one moved to a group the cycle does not fetch
+// is no longer listed either; those are marked out of scope instead.
+func (s *Service) markDeletedProjects(ctx context.Context, c *cycle, logger *slog.Logger) {
+	var groupIDs []string
+	if !c.scope.allProjects {
+		for _, group := range c.scope.groups {
+			if c.checkpoint(group).Done {
+				groupIDs = append(groupIDs, group)
+			}
+		}
+		if len(groupIDs) == 0 {
+			return
+		}
+	}
+
+	unlisted, err := s.db.ListUnlistedProjects(ctx, s.instance, c.id, groupIDs)
+	if err != nil {
+		logger.Warn("failed to list projects no longer listed", logging.Err(err))
+		return
+	}
+
+	var gone, outOfScope []int
+	for _, projectID := range unlisted {
+		_, _, err := s.gitlabClient.Projects.GetProject(projectID, nil, gitlab.WithContext(ctx))
+		switch {
+		case err == nil:
+			outOfScope = append(outOfScope, projectID)
+		case errors.Is(err, gitlab.ErrNotFound):
+			gone = append(gone, projectID)
+		case ctx.Err() != nil:
+			return
+		default:
+			// Left as is and looked up again after the next cycle
+			logger.Warn("failed to look up project no longer listed",
+				logging.ProjectID(projectID),
+				logging.Err(err),
+			)
+		}
+	}
+
+	if len(outOfScope) > 0 {
+		if err := s.db.MarkOutOfScopeProjects(ctx, s.instance, outOfScope); err != nil {
+			logger.Warn("failed to mark projects out of scope", logging.Err(err))
+		} else {
+			logger.Info("marked projects no longer listed as out of scope", slog.Int("projects", len(outOfScope)))
+		}
+	}
+
+	if len(gone) == 0 {
+		return
+	}
+	deleted, err := s.db.MarkDeletedProjects(ctx, s.instance, gone)
+	if err != nil {
+		logger.Warn("failed to mark deleted projects", logging.Err(err))
+		return
+	}
+	metrics.ProjectsDeleted.WithLabelValues(s.instance).Add(float64(deleted))
+	if deleted > 0 {
+		logger.Info("marked projects no longer listed as deleted", slog.Int64("projects", deleted))
+	}
+}
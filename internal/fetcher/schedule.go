@@ -0,0 +1,160 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/robfig/cron/v3"
+	"github.com/zcubbs/sbomer/internal/logging"
+	"github.com/zcubbs/sbomer/internal/metrics"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// DefaultSchedule names the cycle run on Settings.Schedule
+const DefaultSchedule = "default"
+
+// Schedule fetches some groups or topics on a cron schedule of its own and publishes
+// their projects with a priority of its own
+type Schedule struct {
+	Name     string
+	Schedule string
+	// GroupIDs are fetched instead of Settings.GroupIDs
+	GroupIDs []string
+	// Topics restricts the schedule to projects with one of them
+	Topics   []string
+	Priority uint8
+}
+
+// scope is what a cycle of one schedule fetches and how it publishes it
+type scope struct {
+	name string
+	// groupIDs are group IDs, paths and patterns; groups holds them resolved by
+	// resolveScope
+	groupIDs []string
+	groups   []string
+	// allGroups adds the top-level groups the token can see to groupIDs
+	allGroups bool
+	// allProjects lists every project of the instance instead of groups
+	allProjects bool
+	// excludedGroups are patterns of groups whose projects are skipped
+	excludedGroups []string
+	// claimedGroups and claimedTopics are left to the schedules that fetch them
+	claimedGroups []string
+	claimedTopics []string
+	// topics, if set, restricts the cycle to projects with one of them
+	topics   []string
+	priority uint8
+}
+
+// scope returns what the named schedule fetches, or false if there is no such schedule.
+// The default schedule leaves out the groups of schedules without topics and the
+// topics of schedules without groups, which are fetched on their own schedules.
+func (s *Settings) scope(name string) (scope, bool) {
+	sc := scope{
+		name:           name,
+		groupIDs:       s.GroupIDs,
+		allGroups:      s.AllGroups,
+		allProjects:    len(s.GroupIDs) == 0 && !s.AllGroups,
+		excludedGroups: s.ExcludeGroups,
+		priority:       s.Priority,
+	}
+
+	if name != DefaultSchedule {
+		i := slices.IndexFunc(s.Schedules, func(schedule Schedule) bool { return schedule.Name == name })
+		if i < 0 {
+			return scope{}, false
+		}
+		schedule := s.Schedules[i]
+		sc.topics = schedule.Topics
+		sc.priority = schedule.Priority
+		if len(schedule.GroupIDs) > 0 {
+			sc.groupIDs = schedule.GroupIDs
+			sc.allGroups = false
+			sc.allProjects = false
+		}
+		return sc, true
+	}
+
+	for _, schedule := range s.Schedules {
+		switch {
+		case len(schedule.Topics) == 0:
+			sc.claimedGroups = append(sc.claimedGroups, schedule.GroupIDs...)
+		case len(schedule.GroupIDs) == 0:
+			sc.claimedTopics = append(sc.claimedTopics, schedule.Topics...)
+		}
+	}
+	return sc, true
+}
+
+// claims reports whether a listed project belongs to the schedule, or the filter reason
+// it does not
+func (sc *scope) claims(project *gitlab.Project) (bool, string) {
+	var namespace string
+	if project.Namespace != nil {
+		namespace = project.Namespace.FullPath
+	}
+	if inGroups(namespace, sc.excludedGroups) {
+		return false, metrics.FilterExcludedGroup
+	}
+	if len(sc.topics) > 0 && !hasAnyTopic(project, sc.topics) {
+		return false, metrics.FilterMissingTopic
+	}
+	if hasAnyTopic(project, sc.claimedTopics) || inGroups(namespace, sc.claimedGroups) {
+		return false, metrics.FilterOtherSchedule
+	}
+	return true, ""
+}
+
+func hasAnyTopic(project *gitlab.Project, topics []string) bool {
+	for _, topic := range project.Topics {
+		if slices.Contains(topics, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// schedule registers a fetch cycle for the default schedule and each of settings.Schedules
+// on the cron scheduler, replacing any previous registrations
+func (s *Service) schedule(ctx context.Context, settings *Settings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	specs := []Schedule{{Name: DefaultSchedule, Schedule: settings.Schedule}}
+	specs = append(specs, settings.Schedules...)
+
+	entries := make([]cron.EntryID, 0, len(specs))
+	for _, spec := range specs {
+		name := spec.Name
+		entry, err := s.cron.AddFunc(spec.Schedule, func() {
+			s.logger.Info("running scheduled fetch and publish job", slog.String("schedule", name))
+			if err := s.runCycle(ctx, name); err != nil {
+				s.logger.Error("fetch and publish failed", slog.String("schedule", name), logging.Err(err))
+			}
+		})
+		if err != nil {
+			for _, added := range entries {
+				s.cron.Remove(added)
+			}
+			return fmt.Errorf("failed to add cron job for schedule %q: %w", name, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, entry := range s.cronEntries {
+		s.cron.Remove(entry)
+	}
+	s.cronEntries = entries
+	return nil
+}
+
+// scheduleNames returns the names of the default schedule and of settings.Schedules
+func scheduleNames(settings *Settings) []string {
+	names := []string{DefaultSchedule}
+	for _, schedule := range settings.Schedules {
+		names = append(names, schedule.Name)
+	}
+	return names
+}
@@ -0,0 +1,18 @@
+package gitlab
+
+// tokenEnv is the variable through which the token is handed to git's credential helper
+const tokenEnv = "SBOMER_GIT_TOKEN"
+
+// credentialHelper answers git's credential requests with the token from tokenEnv. It
+// runs as a shell snippet so that the token only ever lives in git's environment and
+// never on a command line or on disk.
+const credentialHelper = `!f() { test "$1" = get || return 0; echo username=oauth2; echo "password=$` + tokenEnv + `"; }; f`
+
+// credentialArgs returns git options that replace any configured credential helpers
+// with credentialHelper
+func credentialArgs() []string {
+	return []string{
+		"-c", "credential.helper=",
+		"-c", "credential.helper=" + credentialHelper,
+	}
+}
@@ -0,0 +1,98 @@
+package gitlab
+
+import (
+	"errors"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/zcubbs/sbomer/internal/failure"
+	gc "gitlab.com/gitlab-org/api/client-go"
+)
+
+// gitStderrPatterns maps git's fatal, error and remote messages to failure categories,
+// checked in order against each line of its lowercased stderr
+var gitStderrPatterns = []struct {
+	pattern  *regexp.Regexp
+	category failure.Category
+}{
+	{regexp.MustCompile(`^(fatal|error): .*(no space left on device|disk quota exceeded)`), failure.CategoryDiskFull},
+	{regexp.MustCompile(`^fatal: authentication failed for `), failure.CategoryAuth},
+	{regexp.MustCompile(`^remote: http basic: access denied`), failure.CategoryAuth},
+	{regexp.MustCompile(`^fatal: could not read (username|password) for `), failure.CategoryAuth},
+	{regexp.MustCompile(`^fatal: unable to access '.*': the requested url returned error: 40[13]`), failure.CategoryAuth},
+	{regexp.MustCompile(`^fatal: repository '.*' not found`), failure.CategoryNotFound},
+	{regexp.MustCompile(`^remote: the project you were looking for could not be found`), failure.CategoryNotFound},
+	{regexp.MustCompile(`^fatal: '.*' does not appear to be a git repository`), failure.CategoryNotFound},
+	{regexp.MustCompile(`^fatal: unable to access '.*': the requested url returned error: 404`), failure.CategoryNotFound},
+	{regexp.MustCompile(`^fatal: unable to access '.*': the requested url returned error: 429`), failure.CategoryRateLimited},
+	{regexp.MustCompile(`^fatal: unable to access '.*': .*timed out`), failure.CategoryTimeout},
+	{regexp.MustCompile(`^fatal: unable to access '.*': (could not resolve host|failed to connect|connection refused|recv failure|send failure)`), failure.CategoryNetwork},
+	{regexp.MustCompile(`^fatal: unable to access '.*': .*(ssl|tls|gnutls)`), failure.CategoryNetwork},
+	{regexp.MustCompile(`^fatal: unable to access '.*': the requested url returned error: 5\d\d`), failure.CategoryNetwork},
+	{regexp.MustCompile(`^error: rpc failed`), failure.CategoryNetwork},
+	{regexp.MustCompile(`^fatal: early eof`), failure.CategoryNetwork},
+	{regexp.MustCompile(`^fatal: the remote end hung up unexpectedly`), failure.CategoryNetwork},
+}
+
+// classifyCloneError categorizes a failed git clone from its exit status and stderr
+func classifyCloneError(err error, stderr string) failure.Category {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		// git could not be started at all
+		if errors.Is(err, exec.ErrNotFound) {
+			return failure.CategoryConfiguration
+		}
+		return failure.CategoryOf(err)
+	}
+
+	// git was killed by a signal rather than exiting on its own
+	if exitErr.ExitCode() == -1 {
+		return failure.CategoryToolCrash
+	}
+
+	lines := strings.Split(strings.ToLower(stderr), "\n")
+	for _, pattern := range gitStderrPatterns {
+		for _, line := range lines {
+			if pattern.pattern.MatchString(strings.TrimSpace(line)) {
+				return pattern.category
+			}
+		}
+	}
+
+	// git uses 128 for fatal errors it could not attribute to anything more specific
+	if exitErr.ExitCode() == 128 {
+		return failure.CategoryUnknown
+	}
+	return failure.CategoryToolCrash
+}
+
+// classifyAPIError categorizes a failed GitLab API request from its response status
+func classifyAPIError(err error) failure.Category {
+	// The client reports 404 responses as ErrNotFound rather than an ErrorResponse
+	if errors.Is(err, gc.ErrNotFound) {
+		return failure.CategoryNotFound
+	}
+
+	var errResp *gc.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		if category := failure.CategoryOf(err); category != failure.CategoryUnknown {
+			return category
+		}
+		return failure.CategoryNetwork
+	}
+
+	switch code := errResp.Response.StatusCode; {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return failure.CategoryAuth
+	case code == http.StatusNotFound:
+		return failure.CategoryNotFound
+	case code == http.StatusTooManyRequests:
+		return failure.CategoryRateLimited
+	case code >= http.StatusInternalServerError:
+		return failure.CategoryNetwork
+	default:
+		return failure.CategoryUnknown
+	}
+}
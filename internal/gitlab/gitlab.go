@@ -1,20 +1,51 @@
 package gitlab
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/zcubbs/sbomer/internal/failure"
+	"github.com/zcubbs/sbomer/internal/logging"
+	"github.com/zcubbs/sbomer/internal/metrics"
+	"github.com/zcubbs/sbomer/internal/proc"
+	"github.com/zcubbs/sbomer/internal/tracing"
 	gc "gitlab.com/gitlab-org/api/client-go"
+	"golang.org/x/time/rate"
 )
 
 type Client struct {
-	token   string
+	token   *Token
 	host    string
 	scheme  string
 	tempDir string
 	client  *gc.Client
+	logger  *slog.Logger
+
+	limits      proc.Limits
+	maxRepoSize int64
+}
+
+type Config struct {
+	Token   *Token
+	Host    string
+	Scheme  string
+	TempDir string
+	Logger  *slog.Logger
+
+	// Limits are the resource limits of git processes
+	Limits proc.Limits
+	// MaxRepoSize rejects clones whose checkout is larger than this many bytes; zero disables the check
+	MaxRepoSize int64
+	// RateLimit paces and retries API requests
+	RateLimit RateLimit
 }
 
 type ProjectDetails struct {
@@ -24,70 +55,167 @@ type ProjectDetails struct {
 	Topics       []string
 	ClonePath    string
 	CommitBranch string
+	EmptyRepo    bool
+	// RepositorySize is the size of the repository GitLab reports, or zero if the token
+	// may not read the project's statistics
+	RepositorySize int64
+
+	Namespace      string
+	Visibility     string
+	LastActivityAt *time.Time
+	// CustomAttributes are only returned to administrators
+	CustomAttributes map[string]string
+
+	// CommitSHA is the commit that was cloned; it is set by CloneProject
+	CommitSHA string
+
+	// Maintainers, Languages and CodeOwners are set by EnrichProject
+	Maintainers []Maintainer
+	Languages   map[string]float32
+	CodeOwners  []CodeOwnersRule
+}
+
+// APIConfig configures a GitLab API client
+type APIConfig struct {
+	Token     *Token
+	BaseURL   string
+	RateLimit RateLimit
+	Logger    *slog.Logger
+}
+
+// NewAPIClient creates a GitLab API client whose requests are rate limited, retried,
+// instrumented with metrics and traces and always carry the current value of the token
+func NewAPIClient(config APIConfig) (*gc.Client, error) {
+	// The token is set on every attempt, so that retries pick up a rotated token
+	transport := config.Token.RoundTripper(tracing.RoundTripper(metrics.InstrumentRoundTripper(http.DefaultTransport)))
+	httpClient := &http.Client{
+		Transport: newRateLimiter(transport, config.RateLimit, logging.Component(config.Logger, "gitlab")),
+	}
+
+	// Rate limiting and retries are left to the transport, which honors the rate
+	// limit headers of every response
+	client, err := gc.NewClient(config.Token.Get(),
+		gc.WithBaseURL(config.BaseURL),
+		gc.WithHTTPClient(httpClient),
+		gc.WithCustomLimiter(rate.NewLimiter(rate.Inf, 0)),
+		gc.WithoutRetries())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitLab client: %w", err)
+	}
+
+	return client, nil
+}
+
+// PingAPI verifies that the GitLab API is reachable and accepts the configured token
+func PingAPI(ctx context.Context, client *gc.Client) error {
+	if _, _, err := client.Version.GetVersion(gc.WithContext(ctx)); err != nil {
+		return fmt.Errorf("failed to reach GitLab API: %w", err)
+	}
+	return nil
 }
 
 // New creates a new GitLab client
-func New(token, host, scheme, tempDir string) (*Client, error) {
+func New(config Config) (*Client, error) {
 	// Create GitLab API client
-	client, err := gc.NewClient(token,
-		gc.WithBaseURL(fmt.Sprintf("%s://%s/api/v4", scheme, host)))
+	client, err := NewAPIClient(APIConfig{
+		Token:     config.Token,
+		BaseURL:   fmt.Sprintf("%s://%s/api/v4", config.Scheme, config.Host),
+		RateLimit: config.RateLimit,
+		Logger:    config.Logger,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GitLab client: %w", err)
+		return nil, err
 	}
 
 	return &Client{
-		token:   token,
-		host:    host,
-		scheme:  scheme,
-		tempDir: tempDir,
+		token:   config.Token,
+		host:    config.Host,
+		scheme:  config.Scheme,
+		tempDir: config.TempDir,
 		client:  client,
+		logger:  logging.Component(config.Logger, "gitlab"),
+
+		limits:      config.Limits,
+		maxRepoSize: config.MaxRepoSize,
 	}, nil
 }
 
+// Ping verifies that the GitLab API is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	return PingAPI(ctx, c.client)
+}
+
 // GetProjectDetails fetches project details from GitLab API
-func (c *Client) GetProjectDetails(projectID int) (*ProjectDetails, error) {
-	project, _, err := c.client.Projects.GetProject(projectID, nil)
+func (c *Client) GetProjectDetails(ctx context.Context, projectID int) (*ProjectDetails, error) {
+	opt := &gc.GetProjectOptions{
+		Statistics:           gc.Ptr(true),
+		WithCustomAttributes: gc.Ptr(true),
+	}
+	project, _, err := c.client.Projects.GetProject(projectID, opt, gc.WithContext(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get project details: %w", err)
+		return nil, failure.New(classifyAPIError(err), fmt.Errorf("failed to get project details: %w", err))
 	}
 
-	return &ProjectDetails{
-		ID:           project.ID,
-		Name:         project.Name,
-		Path:         project.PathWithNamespace,
-		Topics:       project.Topics,
-		ClonePath:    project.PathWithNamespace,
-		CommitBranch: project.DefaultBranch,
-	}, nil
+	details := &ProjectDetails{
+		ID:             project.ID,
+		Name:           project.Name,
+		Path:           project.PathWithNamespace,
+		Topics:         project.Topics,
+		ClonePath:      project.PathWithNamespace,
+		CommitBranch:   project.DefaultBranch,
+		EmptyRepo:      project.EmptyRepo,
+		Visibility:     string(project.Visibility),
+		LastActivityAt: project.LastActivityAt,
+	}
+	if project.Namespace != nil {
+		details.Namespace = project.Namespace.FullPath
+	}
+	if project.Statistics != nil {
+		details.RepositorySize = project.Statistics.RepositorySize
+	}
+	if len(project.CustomAttributes) > 0 {
+		details.CustomAttributes = make(map[string]string, len(project.CustomAttributes))
+		for _, attribute := range project.CustomAttributes {
+			details.CustomAttributes[attribute.Key] = attribute.Value
+		}
+	}
+
+	return details, nil
 }
 
 // CloneProject clones the specified GitLab project into a temporary directory
-func (c *Client) CloneProject(projectID int) (string, string, *ProjectDetails, error) {
+func (c *Client) CloneProject(ctx context.Context, projectID int) (string, string, *ProjectDetails, error) {
 	// Get project details
-	details, err := c.GetProjectDetails(projectID)
+	details, err := c.GetProjectDetails(ctx, projectID)
 	if err != nil {
-		return "", "", nil, fmt.Errorf("failed to get project details: %w", err)
+		return "", "", nil, err
+	}
+
+	// There is nothing to clone or scan in a repository without commits
+	if details.EmptyRepo {
+		return "", "", nil, failure.Newf(failure.CategoryEmptyRepository, "repository %s is empty", details.Path)
+	}
+
+	// Reject repositories GitLab reports as too large before they reach the disk; the
+	// checkout is measured again after cloning, since statistics may be missing or stale
+	if c.maxRepoSize > 0 && details.RepositorySize > c.maxRepoSize {
+		return "", "", nil, failure.Newf(failure.CategoryTooLarge,
+			"repository %s is %d bytes according to GitLab, larger than the limit of %d bytes",
+			details.Path, details.RepositorySize, c.maxRepoSize)
 	}
 
 	// Create temp directory for the project
 	localPath := filepath.Join(c.tempDir, fmt.Sprintf("project-%d", projectID))
 	if err := os.MkdirAll(c.tempDir, 0755); err != nil {
-		return "", "", nil, fmt.Errorf("failed to create temp directory: %w", err)
+		return "", "", nil, failure.New(failure.CategoryOf(err), fmt.Errorf("failed to create temp directory: %w", err))
 	}
 
 	// Clean existing directory if it exists
 	if err := os.RemoveAll(localPath); err != nil {
-		return "", "", nil, fmt.Errorf("failed to clean existing project directory: %w", err)
+		return "", "", nil, failure.New(failure.CategoryOf(err), fmt.Errorf("failed to clean existing project directory: %w", err))
 	}
 
-	// Build correct clone URL using standard GitLab repository format
-	cloneURL := fmt.Sprintf("%s://%s@%s/%s.git",
-		c.scheme,
-		fmt.Sprintf("oauth2:%s", c.token),
-		c.host,
-		details.ClonePath,
-	)
-
+	// The token is never part of the URL; git gets it from the credential helper
 	cloneUrlWithoutToken := fmt.Sprintf("%s://%s/%s.git",
 		c.scheme,
 		c.host,
@@ -95,35 +223,139 @@ func (c *Client) CloneProject(projectID int) (string, string, *ProjectDetails, e
 	)
 
 	// Set up git command
-	fmt.Printf("Cloning repository %s from %s...\n", cloneUrlWithoutToken, c.host)
-	cmd := exec.Command("git", "clone", "--depth", "1", cloneURL, localPath)
-	cmd.Stderr = os.Stderr // Show git errors in console for debugging
+	logger := c.logger.With(logging.ProjectID(projectID), logging.Operation("clone"))
+	logger.Info("cloning repository", slog.String("url", cloneUrlWithoutToken))
+	args := append(credentialArgs(), "clone", "--depth", "1", cloneUrlWithoutToken, localPath)
+	cmd := proc.Command(ctx, "git", args...)
+	cmd.Env = proc.Env([]string{"GIT_SSL_"},
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		tokenEnv+"="+c.token.Get(),
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	cleanupLimits, err := proc.Apply(cmd, c.limits)
+	if err != nil {
+		return "", "", nil, failure.New(failure.CategoryConfiguration, err)
+	}
 
 	// Run git clone command
-	if err := cmd.Run(); err != nil {
-		return "", "", nil, fmt.Errorf("failed to clone repository: %w", err)
+	startTime := time.Now()
+	err = cmd.Run()
+	duration := time.Since(startTime)
+	cleanupLimits()
+	metrics.CloneDuration.Observe(duration.Seconds())
+	if err != nil {
+		// Leave no partial clone behind when git was interrupted
+		_ = os.RemoveAll(localPath)
+		if ctxErr := proc.ContextError(ctx, "git clone"); ctxErr != nil {
+			logger.Error("clone interrupted", logging.Duration(duration), logging.Category(failure.CategoryOf(ctxErr)), logging.Err(ctxErr))
+			return "", "", nil, ctxErr
+		}
+
+		category := classifyCloneError(err, stderr.String())
+		logger.Error("failed to clone repository",
+			logging.Duration(duration),
+			logging.Category(category),
+			slog.String("stderr", strings.TrimSpace(stderr.String())),
+			logging.Err(err),
+		)
+		return "", "", nil, failure.New(category, fmt.Errorf("failed to clone repository: %w", err))
+	}
+
+	// Repositories emptied after the API reported them clone with only a warning
+	if strings.Contains(stderr.String(), "cloned an empty repository") {
+		_ = os.RemoveAll(localPath)
+		return "", "", nil, failure.Newf(failure.CategoryEmptyRepository, "repository %s is empty", details.Path)
+	}
+
+	size, err := dirSize(localPath)
+	if err != nil {
+		logger.Warn("failed to measure repository size", logging.Err(err))
+	} else {
+		metrics.CloneSize.Observe(float64(size))
+	}
+	logger.Info("cloned repository", logging.Duration(duration), slog.Int64("size_bytes", size))
+
+	if c.maxRepoSize > 0 && size > c.maxRepoSize {
+		_ = os.RemoveAll(localPath)
+		return "", "", nil, failure.Newf(failure.CategoryTooLarge,
+			"repository %s is %d bytes, larger than the limit of %d bytes", details.Path, size, c.maxRepoSize)
+	}
+
+	details.CommitSHA, err = headCommit(ctx, localPath)
+	if err != nil {
+		logger.Warn("failed to resolve cloned commit", logging.Err(err))
+	}
+
+	// Keep the scanner from modifying the checkout
+	if err := setReadOnly(localPath, true); err != nil {
+		logger.Warn("failed to make repository read-only", logging.Err(err))
 	}
 
 	return localPath, cloneUrlWithoutToken, details, nil
 }
 
-// getAPIBaseURL returns the base URL for API requests
-func (c *Client) getAPIBaseURL() string {
-	return fmt.Sprintf("%s://%s/api/v4", c.scheme, c.host)
+// headCommit returns the commit checked out in the repository at path
+func headCommit(ctx context.Context, path string) (string, error) {
+	cmd := proc.Command(ctx, "git", "-C", path, "rev-parse", "HEAD")
+	cmd.Env = proc.Env(nil, "GIT_CONFIG_NOSYSTEM=1")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
 }
 
-// getBaseURL returns the base URL for API requests with the token
-func (c *Client) getBaseURL() string {
-	return fmt.Sprintf("%s://oauth2:%s@%s", c.scheme, c.token, c.host)
+// dirSize returns the total size of the regular files below root
+func dirSize(root string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
 }
 
-// getAPIBaseURLWithToken returns the base URL for API requests with the token
-func (c *Client) getAPIBaseURLWithToken() string {
-	return fmt.Sprintf("%s://%s@%s/api/v4", c.scheme, c.token, c.host)
+// setReadOnly removes or restores write permissions on everything below root
+func setReadOnly(root string, readOnly bool) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := info.Mode().Perm()
+		if readOnly {
+			mode &^= 0222
+		} else {
+			mode |= 0200
+		}
+		return os.Chmod(path, mode)
+	})
 }
 
 // CleanupRepository cleans up the cloned project directory
 func (c *Client) CleanupRepository(projectPath string) error {
+	// Directories made read-only after cloning must be writable again to remove their entries
+	if err := setReadOnly(projectPath, false); err != nil && !os.IsNotExist(err) {
+		c.logger.Warn("failed to restore repository permissions", logging.Err(err))
+	}
 	if err := os.RemoveAll(projectPath); err != nil {
 		return fmt.Errorf("failed to cleanup repository: %w", err)
 	}
@@ -0,0 +1,199 @@
+package gitlab
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	gc "gitlab.com/gitlab-org/api/client-go"
+)
+
+// codeOwnersPaths are the locations GitLab reads CODEOWNERS from, in order of precedence
+var codeOwnersPaths = []string{"CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+// maxCodeOwnersSize bounds how much of a CODEOWNERS file is read
+const maxCodeOwnersSize = 1 << 20
+
+// codeOwnersSection matches section headers such as [Backend], ^[Docs][2] @docs-team
+var codeOwnersSection = regexp.MustCompile(`^\^?\[([^\]]+)\](?:\[\d+\])?\s*(.*)$`)
+
+// Maintainer is a project member with at least the Maintainer role, directly or
+// inherited from a parent group. Emails are left out, since events are broadcast to
+// every consumer of the queue.
+type Maintainer struct {
+	Username    string `json:"username"`
+	Name        string `json:"name"`
+	AccessLevel int    `json:"accessLevel"`
+}
+
+// CodeOwnersRule assigns the owners of the files matching a CODEOWNERS pattern
+type CodeOwnersRule struct {
+	Section string   `json:"section,omitempty"`
+	Pattern string   `json:"pattern"`
+	Owners  []string `json:"owners"`
+}
+
+// EnrichProject adds the maintainers, languages and CODEOWNERS rules of a project to its
+// details, reading CODEOWNERS from the checkout at repoPath. Lookups that fail are left
+// nil and their errors returned together, so callers can go on without them.
+func (c *Client) EnrichProject(ctx context.Context, details *ProjectDetails, repoPath string) error {
+	var errs []error
+
+	maintainers, err := c.projectMaintainers(ctx, details.ID)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	details.Maintainers = maintainers
+
+	languages, _, err := c.client.Projects.GetProjectLanguages(details.ID, gc.WithContext(ctx))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to get project languages: %w", err))
+	} else if languages != nil {
+		details.Languages = *languages
+	}
+
+	if repoPath != "" {
+		rules, err := readCodeOwners(repoPath)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		details.CodeOwners = rules
+	}
+
+	return errors.Join(errs...)
+}
+
+// projectMaintainers lists the active members of a project with at least the Maintainer role
+func (c *Client) projectMaintainers(ctx context.Context, projectID int) ([]Maintainer, error) {
+	opt := &gc.ListProjectMembersOptions{
+		ListOptions: gc.ListOptions{PerPage: 100, Page: 1},
+	}
+
+	maintainers := []Maintainer{}
+	for {
+		members, resp, err := c.client.ProjectMembers.ListAllProjectMembers(projectID, opt, gc.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list project members: %w", err)
+		}
+		for _, member := range members {
+			if member.AccessLevel < gc.MaintainerPermissions || member.State != "active" {
+				continue
+			}
+			maintainers = append(maintainers, Maintainer{
+				Username:    member.Username,
+				Name:        member.Name,
+				AccessLevel: int(member.AccessLevel),
+			})
+		}
+
+		if resp.NextPage == 0 {
+			return maintainers, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// readCodeOwners parses the CODEOWNERS file GitLab would use for the checkout at
+// repoPath, returning an empty list if there is none. Since the checkout is untrusted,
+// a CODEOWNERS file or directory symlinked to a path outside of it is ignored.
+func readCodeOwners(repoPath string) ([]CodeOwnersRule, error) {
+	root, err := filepath.EvalSymlinks(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve checkout path: %w", err)
+	}
+
+	for _, name := range codeOwnersPaths {
+		path, err := filepath.EvalSymlinks(filepath.Join(root, name))
+		if err != nil || !withinDir(root, path) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, maxCodeOwnersSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		return parseCodeOwners(data), nil
+	}
+	return []CodeOwnersRule{}, nil
+}
+
+// withinDir reports whether path lies below dir
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// parseCodeOwners parses the rules of a CODEOWNERS file. Rules without owners inherit the
+// default owners of their section.
+func parseCodeOwners(data []byte) []CodeOwnersRule {
+	rules := []CodeOwnersRule{}
+	var section string
+	var defaultOwners []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if match := codeOwnersSection.FindStringSubmatch(line); match != nil {
+			section = match[1]
+			defaultOwners = ownerFields(match[2])
+			continue
+		}
+
+		pattern, owners := splitCodeOwnersRule(line)
+		if len(owners) == 0 {
+			owners = defaultOwners
+		}
+		if len(owners) == 0 {
+			continue
+		}
+		rules = append(rules, CodeOwnersRule{Section: section, Pattern: pattern, Owners: owners})
+	}
+	return rules
+}
+
+// splitCodeOwnersRule splits a rule into its pattern, in which spaces and # may be
+// escaped with a backslash, and its owners
+func splitCodeOwnersRule(line string) (string, []string) {
+	var pattern strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			i++
+			pattern.WriteByte(line[i])
+		case line[i] == ' ' || line[i] == '\t':
+			return pattern.String(), ownerFields(line[i:])
+		default:
+			pattern.WriteByte(line[i])
+		}
+	}
+	return pattern.String(), nil
+}
+
+// ownerFields returns the owners listed in s, dropping a trailing comment
+func ownerFields(s string) []string {
+	if i := strings.Index(s, "#"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Fields(s)
+}
@@ -0,0 +1,228 @@
+package gitlab
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/zcubbs/sbomer/internal/metrics"
+	"golang.org/x/time/rate"
+)
+
+// RateLimit configures client-side rate limiting and retries of GitLab API requests
+type RateLimit struct {
+	// RequestsPerSecond and Burst size the token bucket requests wait on; zero disables it
+	RequestsPerSecond float64
+	Burst             int
+	// MaxRetries bounds how often a request answered with 429 or 5xx is retried
+	MaxRetries int
+	// MaxRetryDelay caps the wait between retries; zero leaves it uncapped
+	MaxRetryDelay time.Duration
+}
+
+// retryBaseDelay is the backoff before the first retry of a response without Retry-After
+const retryBaseDelay = time.Second
+
+// rateLimiter spaces requests by a token bucket, holds them back while the server's
+// budget is exhausted and retries rate-limited requests and server errors
+type rateLimiter struct {
+	next   http.RoundTripper
+	bucket *rate.Limiter
+	config RateLimit
+	logger *slog.Logger
+
+	// resumeAt is when requests may continue after the server ran out of budget, in
+	// Unix nanoseconds; it is shared by all requests of the client
+	resumeAt atomic.Int64
+}
+
+func newRateLimiter(next http.RoundTripper, config RateLimit, logger *slog.Logger) *rateLimiter {
+	r := &rateLimiter{
+		next:   next,
+		config: config,
+		logger: logger,
+	}
+	if config.RequestsPerSecond > 0 {
+		r.bucket = rate.NewLimiter(rate.Limit(config.RequestsPerSecond), max(config.Burst, 1))
+	}
+	return r
+}
+
+func (r *rateLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	host := req.URL.Host
+
+	for attempt := 0; ; attempt++ {
+		if err := r.wait(ctx, host); err != nil {
+			return nil, err
+		}
+
+		resp, err := r.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		r.observe(resp, host)
+
+		if !isRetryableStatus(resp.StatusCode) || attempt >= r.config.MaxRetries {
+			return resp, nil
+		}
+		retryReq, ok := rewind(req)
+		if !ok {
+			return resp, nil
+		}
+
+		delay := r.retryDelay(resp, attempt)
+		metrics.GitLabRequestRetries.WithLabelValues(host, strconv.Itoa(resp.StatusCode)).Inc()
+		r.logger.Debug("retrying GitLab API request",
+			slog.String("method", req.Method),
+			slog.String("path", req.URL.Path),
+			slog.Int("status", resp.StatusCode),
+			slog.Int("attempt", attempt+1),
+			slog.Float64("delay", delay.Seconds()),
+		)
+
+		// Drain the body so the connection can be reused
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		req = retryReq
+	}
+}
+
+// wait blocks until the server's budget has reset and the token bucket admits a request
+func (r *rateLimiter) wait(ctx context.Context, host string) error {
+	start := time.Now()
+	defer func() {
+		metrics.GitLabRateLimitWait.WithLabelValues(host).Observe(time.Since(start).Seconds())
+	}()
+
+	if resumeAt := time.Unix(0, r.resumeAt.Load()); resumeAt.After(start) {
+		if err := sleep(ctx, resumeAt.Sub(start)); err != nil {
+			return err
+		}
+	}
+
+	if r.bucket != nil {
+		return r.bucket.Wait(ctx)
+	}
+	return nil
+}
+
+// observe records the rate limit state the server reported with a response
+func (r *rateLimiter) observe(resp *http.Response, host string) {
+	if remaining, err := strconv.Atoi(resp.Header.Get("RateLimit-Remaining")); err == nil {
+		metrics.GitLabRateLimitRemaining.WithLabelValues(host).Set(float64(remaining))
+
+		// Hold all requests back until the window resets once the budget is spent
+		if remaining <= 0 {
+			if reset, err := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64); err == nil {
+				r.pause(time.Until(time.Unix(reset, 0)))
+			}
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if delay, ok := retryAfter(resp.Header); ok {
+			r.pause(delay)
+		}
+	}
+}
+
+// pause holds requests back for delay, capped like retry delays so that a far-off or
+// bogus reset time cannot stall the client, unless they are held back longer already
+func (r *rateLimiter) pause(delay time.Duration) {
+	next := time.Now().Add(r.capDelay(delay)).UnixNano()
+	for {
+		current := r.resumeAt.Load()
+		if current >= next || r.resumeAt.CompareAndSwap(current, next) {
+			return
+		}
+	}
+}
+
+// retryDelay returns how long to wait before retrying: the server's Retry-After if it
+// sent one, otherwise an exponential backoff. Both are jittered so that clients
+// throttled together do not retry together.
+func (r *rateLimiter) retryDelay(resp *http.Response, attempt int) time.Duration {
+	if delay, ok := retryAfter(resp.Header); ok {
+		return r.capDelay(delay + rand.N(delay/10+time.Millisecond))
+	}
+
+	backoff := r.capDelay(retryBaseDelay << min(attempt, 16))
+	return backoff/2 + rand.N(backoff/2+time.Millisecond)
+}
+
+func (r *rateLimiter) capDelay(delay time.Duration) time.Duration {
+	if r.config.MaxRetryDelay > 0 && delay > r.config.MaxRetryDelay {
+		return r.config.MaxRetryDelay
+	}
+	return delay
+}
+
+// isRetryableStatus reports whether a response status is worth retrying
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// rewind returns a copy of req that can be sent again, or false if its body cannot be
+// replayed
+func rewind(req *http.Request) (*http.Request, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	retryReq := req.Clone(req.Context())
+	retryReq.Body = body
+	return retryReq, true
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
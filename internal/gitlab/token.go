@@ -0,0 +1,43 @@
+package gitlab
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Token is a GitLab access token that can be rotated while clients are using it
+type Token struct {
+	value atomic.Pointer[string]
+}
+
+// NewToken creates a token holding value
+func NewToken(value string) *Token {
+	t := &Token{}
+	t.Set(value)
+	return t
+}
+
+// Get returns the current token
+func (t *Token) Get() string {
+	return *t.value.Load()
+}
+
+// Set replaces the token; requests and clones started afterwards use the new value
+func (t *Token) Set(value string) {
+	t.value.Store(&value)
+}
+
+// RoundTripper sets the current token on every request made through next
+func (t *Token) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.Header.Set("PRIVATE-TOKEN", t.Get())
+		return next.RoundTrip(req)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
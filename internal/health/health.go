@@ -0,0 +1,168 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	defaultTimeout = 5 * time.Second
+)
+
+// CheckFunc reports the health of one dependency, returning nil when healthy
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker runs the registered liveness and readiness checks
+type Checker struct {
+	mu        sync.RWMutex
+	liveness  []check
+	readiness []check
+	timeout   time.Duration
+	ready     atomic.Bool
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Report is the JSON body returned by the probe endpoints
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// New creates a checker that reports not ready until MarkReady is called
+func New() *Checker {
+	c := &Checker{timeout: defaultTimeout}
+	c.AddReadiness("startup", func(context.Context) error {
+		if !c.ready.Load() {
+			return fmt.Errorf("service is starting")
+		}
+		return nil
+	})
+	return c
+}
+
+// MarkReady signals that startup has completed
+func (c *Checker) MarkReady() {
+	c.ready.Store(true)
+}
+
+// AddLiveness registers a check that must pass for the process to be considered alive.
+// Liveness checks also count towards readiness.
+func (c *Checker) AddLiveness(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.liveness = append(c.liveness, check{name: name, fn: fn})
+}
+
+// AddReadiness registers a check that must pass for the process to accept work
+func (c *Checker) AddReadiness(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readiness = append(c.readiness, check{name: name, fn: fn})
+}
+
+// Liveness runs the liveness checks
+func (c *Checker) Liveness(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append([]check(nil), c.liveness...)
+	c.mu.RUnlock()
+	return c.run(ctx, checks)
+}
+
+// Readiness runs the liveness and readiness checks
+func (c *Checker) Readiness(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append(append([]check(nil), c.liveness...), c.readiness...)
+	c.mu.RUnlock()
+	return c.run(ctx, checks)
+}
+
+// run executes checks concurrently, each bounded by the checker timeout
+func (c *Checker) run(ctx context.Context, checks []check) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ch := range checks {
+		wg.Add(1)
+		go func(ch check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			startTime := time.Now()
+			err := ch.fn(checkCtx)
+			result := Result{
+				Status:     StatusOK,
+				DurationMs: float64(time.Since(startTime).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			report.Checks[ch.name] = result
+			if err != nil {
+				report.Status = StatusFail
+			}
+			mu.Unlock()
+		}(ch)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// LivenessHandler serves the liveness report, responding 503 when a check fails
+func (c *Checker) LivenessHandler() http.Handler {
+	return reportHandler(c.Liveness)
+}
+
+// ReadinessHandler serves the readiness report, responding 503 when a check fails
+func (c *Checker) ReadinessHandler() http.Handler {
+	return reportHandler(c.Readiness)
+}
+
+func reportHandler(run func(context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := run(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+// Binary returns a check verifying that the named executable is available in PATH
+func Binary(name string) CheckFunc {
+	return func(context.Context) error {
+		if _, err := exec.LookPath(name); err != nil {
+			return fmt.Errorf("%s not found in PATH: %w", name, err)
+		}
+		return nil
+	}
+}
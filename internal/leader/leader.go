@@ -0,0 +1,180 @@
+package leader
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/zcubbs/sbomer/internal/db"
+	"github.com/zcubbs/sbomer/internal/logging"
+	"github.com/zcubbs/sbomer/internal/metrics"
+)
+
+// Elector elects one leader among replicas sharing a database by holding a Postgres
+// advisory lock. The lock is tied to a database session, so a replica that crashes or
+// loses its connection gives up leadership without any cleanup.
+type Elector struct {
+	db       *db.DB
+	key      int64
+	id       string
+	interval time.Duration
+	logger   *slog.Logger
+
+	// mu guards lock and the current term
+	mu   sync.Mutex
+	lock *db.AdvisoryLock
+	term context.Context
+	end  context.CancelFunc
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type Config struct {
+	DB *db.DB
+	// LockName identifies the election; replicas using the same name elect one leader
+	LockName string
+	// ID identifies this replica in logs and fetch statistics
+	ID string
+	// CheckInterval is how often a follower tries to take the lock and the leader
+	// verifies it still holds it
+	CheckInterval time.Duration
+	Logger        *slog.Logger
+}
+
+func New(config Config) *Elector {
+	return &Elector{
+		db:       config.DB,
+		key:      db.LockKey(config.LockName),
+		id:       config.ID,
+		interval: config.CheckInterval,
+		logger:   logging.Component(config.Logger, "leader").With(slog.String("leader_id", config.ID)),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// ID returns the identity of this replica
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// Start campaigns for leadership once and keeps campaigning in the background until
+// Stop is called or ctx is done
+func (e *Elector) Start(ctx context.Context) {
+	e.campaign(ctx)
+
+	go func() {
+		defer close(e.done)
+
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				e.resign()
+				return
+			case <-e.stop:
+				e.resign()
+				return
+			case <-ticker.C:
+				e.campaign(ctx)
+			}
+		}
+	}()
+}
+
+// Stop ends the campaign and releases the lock if this replica is the leader
+func (e *Elector) Stop() {
+	select {
+	case <-e.stop:
+	default:
+		close(e.stop)
+	}
+	<-e.done
+}
+
+// Lead returns a context for work that only the leader may do and false if this replica
+// is not the leader. The context is canceled when leadership is lost; the returned
+// cancel function must be called when the work is done.
+func (e *Elector) Lead(ctx context.Context) (context.Context, context.CancelFunc, bool) {
+	e.mu.Lock()
+	term := e.term
+	e.mu.Unlock()
+
+	if term == nil || term.Err() != nil {
+		return ctx, func() {}, false
+	}
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(term, cancel)
+	return leaderCtx, func() {
+		stop()
+		cancel()
+	}, true
+}
+
+// campaign takes the lock if it is free, or verifies that the leader still holds it
+func (e *Elector) campaign(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	checkCtx, cancel := context.WithTimeout(ctx, e.interval)
+	defer cancel()
+
+	if e.lock != nil {
+		if err := e.lock.Check(checkCtx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			e.logger.Error("lost leadership", logging.Err(err))
+			metrics.LeadershipChanges.WithLabelValues("lost").Inc()
+			e.stepDown()
+		}
+		return
+	}
+
+	lock, err := e.db.TryAdvisoryLock(checkCtx, e.key)
+	if err != nil {
+		if ctx.Err() == nil {
+			e.logger.Warn("failed to campaign for leadership", logging.Err(err))
+		}
+		return
+	}
+	if lock == nil {
+		return
+	}
+
+	e.lock = lock
+	e.term, e.end = context.WithCancel(context.Background())
+	metrics.Leader.Set(1)
+	metrics.LeadershipChanges.WithLabelValues("acquired").Inc()
+	e.logger.Info("acquired leadership")
+}
+
+// resign gives up leadership on shutdown
+func (e *Elector) resign() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.lock != nil {
+		e.stepDown()
+		e.logger.Info("released leadership")
+	}
+}
+
+// stepDown ends the current term and releases the lock. Callers must hold mu.
+func (e *Elector) stepDown() {
+	e.end()
+	metrics.Leader.Set(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.interval)
+	defer cancel()
+	if err := e.lock.Release(ctx); err != nil {
+		e.logger.Warn("failed to release leader lock", logging.Err(err))
+	}
+	e.lock = nil
+	e.term, e.end = nil, nil
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zcubbs/sbomer/internal/redact"
+)
+
+const (
+	// FormatText writes logfmt-style key=value lines
+	FormatText = "text"
+	// FormatJSON writes one JSON object per line
+	FormatJSON = "json"
+)
+
+// Attribute keys shared by all components
+const (
+	KeyComponent = "component"
+	KeyInstance  = "instance"
+	KeyProjectID = "project_id"
+	KeyJobID     = "job_id"
+	KeyOperation = "operation"
+	KeyDuration  = "duration"
+	KeyCategory  = "error_category"
+	KeyError     = "error"
+)
+
+// New creates a logger writing to stdout with the given level and format
+func New(level, format string) (*slog.Logger, error) {
+	return NewWithWriter(os.Stdout, level, format)
+}
+
+// NewWithWriter creates a logger writing to w with the given level and format
+func NewWithWriter(w io.Writer, level, format string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redactAttr}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
+
+	return slog.New(handler), nil
+}
+
+// redactAttr scrubs credentials from string and error values before they are written
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(redact.String(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(redact.Error(err))
+		}
+	}
+	return a
+}
+
+// ParseLevel converts a configured level name to a slog level
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level: %s", level)
+	}
+}
+
+// Component returns a child logger tagged with the component name, falling back to the default logger
+func Component(logger *slog.Logger, name string) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With(KeyComponent, name)
+}
+
+func Instance(name string) slog.Attr {
+	return slog.String(KeyInstance, name)
+}
+
+func ProjectID(id int) slog.Attr {
+	return slog.Int(KeyProjectID, id)
+}
+
+func JobID(id string) slog.Attr {
+	return slog.String(KeyJobID, id)
+}
+
+func Operation(name string) slog.Attr {
+	return slog.String(KeyOperation, name)
+}
+
+// Duration logs d in seconds so that JSON and text output agree
+func Duration(d time.Duration) slog.Attr {
+	return slog.Float64(KeyDuration, d.Seconds())
+}
+
+// Category logs the failure category of an error
+func Category[T ~string](category T) slog.Attr {
+	return slog.String(KeyCategory, string(category))
+}
+
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.String(KeyError, "")
+	}
+	return slog.String(KeyError, err.Error())
+}
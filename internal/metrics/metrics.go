@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sbomer"
+
+// Filter reasons for ProjectsFiltered
+const (
+	FilterExcludedTopic = "excluded_topic"
+	FilterMissingTopic  = "missing_topic"
+	FilterPendingJob    = "pending_job"
+	FilterOtherSchedule = "other_schedule"
+	FilterExcludedGroup = "excluded_group"
+)
+
+// Fetcher metrics
+var (
+	FetchCycles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "cycles_total",
+		Help:      "Fetch cycles run, by result: completed, failed or interrupted.",
+	}, []string{"result"})
+
+	FetchCycleDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "cycle_duration_seconds",
+		Help:      "Duration of a complete fetch cycle.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 15),
+	})
+
+	ProjectsListed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "projects_listed_total",
+		Help:      "Projects returned by the GitLab API.",
+	})
+
+	ProjectsFiltered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "projects_filtered_total",
+		Help:      "Projects skipped by topic or group filters, a pending job or another schedule, by reason.",
+	}, []string{"reason"})
+
+	ProjectsPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "projects_published_total",
+		Help:      "Projects published to the queue.",
+	})
+
+	PublishErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "publish_errors_total",
+		Help:      "Projects that could not be published to the queue.",
+	})
+
+	LastCycleProjects = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "last_cycle_projects",
+		Help:      "Projects listed, filtered and published during the last completed cycle of each GitLab instance and schedule.",
+	}, []string{"instance", "schedule", "state"})
+
+	GroupFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "group_fetches_total",
+		Help:      "Groups and project ID ranges fetched, by GitLab instance and result: completed, failed or interrupted.",
+	}, []string{"instance", "result"})
+
+	GroupFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "group_fetch_duration_seconds",
+		Help:      "Duration of fetching one group or project ID range, by GitLab instance.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 15),
+	}, []string{"instance"})
+
+	LastCycleGroupProjects = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "last_cycle_group_projects",
+		Help:      "Projects listed, filtered and published during the last completed fetch of each group.",
+	}, []string{"instance", "group", "state"})
+
+	ProjectsDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "projects_deleted_total",
+		Help:      "Projects marked deleted in the inventory because a completed cycle no longer listed them, by GitLab instance.",
+	}, []string{"instance"})
+
+	Leader = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "leader",
+		Help:      "1 while this replica holds the fetcher leader lock.",
+	})
+
+	LeadershipChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "leadership_changes_total",
+		Help:      "Leader lock acquisitions and losses, by event.",
+	}, []string{"event"})
+
+	SkippedCycles = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "skipped_cycles_total",
+		Help:      "Scheduled cycles skipped because another replica is the leader.",
+	})
+)
+
+// GitLab API metrics
+var (
+	GitLabRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "gitlab",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of GitLab API requests, by method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	GitLabRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gitlab",
+		Name:      "request_errors_total",
+		Help:      "GitLab API requests that failed or returned an error status, by method and status code.",
+	}, []string{"method", "code"})
+
+	GitLabRequestRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gitlab",
+		Name:      "request_retries_total",
+		Help:      "GitLab API requests retried after a 429 or 5xx response, by GitLab host and status code.",
+	}, []string{"host", "code"})
+
+	GitLabRateLimitWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "gitlab",
+		Name:      "rate_limit_wait_seconds",
+		Help:      "Time GitLab API requests waited for the rate limiter, by GitLab host.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"host"})
+
+	GitLabRateLimitRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "gitlab",
+		Name:      "rate_limit_remaining",
+		Help:      "Requests left in the current rate limit window as reported by GitLab, by GitLab host.",
+	}, []string{"host"})
+)
+
+// Processor metrics
+var (
+	CloneDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "clone_duration_seconds",
+		Help:      "Duration of git clones.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12),
+	})
+
+	CloneSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "clone_size_bytes",
+		Help:      "Size of cloned repositories on disk.",
+		Buckets:   prometheus.ExponentialBuckets(1024*1024, 4, 10),
+	})
+
+	SyftDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "syft_duration_seconds",
+		Help:      "Duration of syft SBOM generation.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12),
+	})
+
+	SBOMSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "sbom_size_bytes",
+		Help:      "Size of generated SBOM documents.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+	})
+
+	SBOMComponents = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "sbom_components",
+		Help:      "Number of components in generated SBOMs.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 10),
+	})
+
+	QueueDeliveries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "queue_deliveries_total",
+		Help:      "Messages delivered by the queue.",
+	})
+
+	MessageRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "message_retries_total",
+		Help:      "Messages delivered again after a previous failed attempt.",
+	})
+
+	MessageFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "message_failures_total",
+		Help:      "Messages that failed processing, by stage and error category.",
+	}, []string{"stage", "category"})
+
+	MessageRequeues = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "message_requeues_total",
+		Help:      "Failed messages requeued for another attempt, by error category.",
+	}, []string{"category"})
+
+	JobsSuperseded = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processor",
+		Name:      "jobs_superseded_total",
+		Help:      "Jobs skipped because a newer job covers the same commit.",
+	})
+)
+
+// Handler returns the HTTP handler serving all registered metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// InstrumentRoundTripper records latency and errors of GitLab API requests made through next
+func InstrumentRoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return promhttp.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		startTime := time.Now()
+		resp, err := next.RoundTrip(req)
+
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+
+		GitLabRequestDuration.WithLabelValues(req.Method, code).Observe(time.Since(startTime).Seconds())
+		if err != nil || resp.StatusCode >= http.StatusBadRequest {
+			GitLabRequestErrors.WithLabelValues(req.Method, code).Inc()
+		}
+
+		return resp, err
+	})
+}
@@ -6,10 +6,12 @@ import (
 )
 
 type SBOM struct {
+	Instance   string          `db:"instance"`
 	ProjectUID int             `db:"project_uid"`
 	Name       string          `db:"name"`
 	Path       string          `db:"path"`
 	Topics     []string        `db:"topics"`
+	SBOMDigest string          `db:"sbom_digest"`
 	SBOMData   json.RawMessage `db:"sbom_data"`
 	CreatedAt  time.Time       `db:"created_at"`
 	UpdatedAt  time.Time       `db:"updated_at"`
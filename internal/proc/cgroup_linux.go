@@ -0,0 +1,73 @@
+//go:build linux
+
+package proc
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/google/uuid"
+)
+
+// cpuPeriod is the cgroup v2 CPU accounting period in microseconds
+const cpuPeriod = 100000
+
+// Apply places cmd, once started, in a new cgroup v2 group under l.CgroupRoot carrying
+// the limits. The returned cleanup function removes the group and must be called after
+// the command has exited.
+func Apply(cmd *exec.Cmd, l Limits) (func(), error) {
+	if !l.enabled() {
+		return func() {}, nil
+	}
+
+	dir := filepath.Join(l.CgroupRoot, "sbomer-"+uuid.NewString())
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	cleanup := func() { _ = os.Remove(dir) }
+
+	if l.MemoryBytes > 0 {
+		if err := writeCgroupFile(dir, "memory.max", strconv.FormatInt(l.MemoryBytes, 10)); err != nil {
+			cleanup()
+			return nil, err
+		}
+		// Fail allocations instead of swapping the process to a crawl
+		_ = writeCgroupFile(dir, "memory.swap.max", "0")
+	}
+
+	if l.CPUs > 0 {
+		quota := int64(l.CPUs * cpuPeriod)
+		if err := writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%d %d", quota, cpuPeriod)); err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+
+	fd, err := os.Open(dir)
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(fd.Fd())
+
+	return func() {
+		fd.Close()
+		cleanup()
+	}, nil
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+	return nil
+}
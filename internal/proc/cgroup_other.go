@@ -0,0 +1,16 @@
+//go:build !linux
+
+package proc
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// Apply fails if limits are configured, since cgroups are only available on Linux
+func Apply(cmd *exec.Cmd, l Limits) (func(), error) {
+	if l.enabled() {
+		return nil, fmt.Errorf("resource limits require cgroup v2 on linux")
+	}
+	return func() {}, nil
+}
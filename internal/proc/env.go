@@ -0,0 +1,53 @@
+package proc
+
+import (
+	"os"
+	"strings"
+)
+
+// allowedEnv lists the variables passed through to subprocesses. Everything else,
+// including database passwords and GitLab tokens, is withheld.
+var allowedEnv = []string{
+	"PATH",
+	"HOME",
+	"TMPDIR",
+	"LANG",
+	"LC_ALL",
+	"TZ",
+	"SSL_CERT_FILE",
+	"SSL_CERT_DIR",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"http_proxy",
+	"https_proxy",
+	"no_proxy",
+}
+
+// Env returns a minimal environment for subprocesses built from the allowlisted
+// variables of the current process, the variables whose names start with one of
+// prefixes, and extra "KEY=value" entries
+func Env(prefixes []string, extra ...string) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if allowed(name, prefixes) {
+			env = append(env, kv)
+		}
+	}
+	return append(env, extra...)
+}
+
+func allowed(name string, prefixes []string) bool {
+	for _, allowedName := range allowedEnv {
+		if name == allowedName {
+			return true
+		}
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+package proc
+
+// Limits are resource limits applied to a subprocess through a cgroup v2 child group
+// of CgroupRoot. Limits with an empty CgroupRoot or no limits set are not applied.
+type Limits struct {
+	CgroupRoot  string
+	MemoryBytes int64
+	CPUs        float64
+}
+
+// enabled reports whether any limit should be applied
+func (l Limits) enabled() bool {
+	return l.CgroupRoot != "" && (l.MemoryBytes > 0 || l.CPUs > 0)
+}
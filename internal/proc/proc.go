@@ -0,0 +1,44 @@
+package proc
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	"github.com/zcubbs/sbomer/internal/failure"
+)
+
+// KillGracePeriod is how long a cancelled process group gets to exit after SIGTERM
+// before it is killed
+const KillGracePeriod = 10 * time.Second
+
+// Command returns a command that runs in its own process group. When ctx is done the
+// whole group is terminated, so that children such as git's remote helpers do not
+// outlive it.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = KillGracePeriod + time.Second
+	return cmd
+}
+
+// ContextError returns a categorized error if the command failed because ctx timed out
+// or was cancelled, or nil if it failed on its own
+func ContextError(ctx context.Context, op string) error {
+	switch err := ctx.Err(); err {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return failure.Newf(failure.CategoryTimeout, "%s timed out: %w", op, err)
+	default:
+		return failure.Newf(failure.CategoryCanceled, "%s was cancelled: %w", op, err)
+	}
+}
+
+// WithTimeout derives a context with the given timeout, or without one if it is zero
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
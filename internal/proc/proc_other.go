@@ -0,0 +1,9 @@
+//go:build !unix
+
+package proc
+
+import "os/exec"
+
+// setProcessGroup is a no-op where process groups are not supported; cancellation
+// kills only the process itself
+func setProcessGroup(cmd *exec.Cmd) {}
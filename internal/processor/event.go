@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zcubbs/sbomer/internal/cloudevents"
+	"github.com/zcubbs/sbomer/internal/failure"
+	"github.com/zcubbs/sbomer/internal/rabbitmq"
+)
+
+const (
+	// EventFormatRaw publishes the SbomScanRequestEvent as a plain JSON body
+	EventFormatRaw = "raw"
+	// EventFormatCloudEvents wraps the SbomScanRequestEvent in a CloudEvents 1.0 envelope
+	EventFormatCloudEvents = "cloudevents"
+)
+
+// EventConfig controls how scan request events are encoded
+type EventConfig struct {
+	Format          string
+	ContentMode     string
+	Source          string
+	Type            string
+	SBOMURLTemplate string
+}
+
+// sbomMediaTypes maps the supported syft output formats to the media types of their
+// documents. Only JSON formats are supported, since SBOMs are stored as canonical JSON
+// and embedded in events as is.
+var sbomMediaTypes = map[string]string{
+	"cyclonedx-json": "application/vnd.cyclonedx+json",
+	"spdx-json":      "application/spdx+json",
+	"syft-json":      "application/vnd.syft+json",
+	"github-json":    "application/json",
+}
+
+// sbomMediaType returns the media type of SBOMs in a syft output format, falling back to
+// a generic binary type for formats without a known one
+func sbomMediaType(format string) string {
+	if mediaType, ok := sbomMediaTypes[format]; ok {
+		return mediaType
+	}
+	return "application/octet-stream"
+}
+
+// sbomURL expands the SBOM URL template placeholders for the given metadata
+func (c EventConfig) sbomURL(metadata Metadata) string {
+	return strings.NewReplacer(
+		"{instance}", metadata.Instance,
+		"{projectId}", metadata.ProjectId,
+		"{projectTitle}", metadata.ProjectTitle,
+		"{jobId}", metadata.JobId,
+	).Replace(c.SBOMURLTemplate)
+}
+
+// newScanRequestEvent builds the event for an SBOM. The SBOM is referenced by URL when a
+// template is configured, offloaded to the artifact store when it exceeds the threshold,
+// and embedded otherwise.
+func (p *Processor) newScanRequestEvent(ctx context.Context, metadata Metadata, sbomData []byte) (SbomScanRequestEvent, error) {
+	event := SbomScanRequestEvent{
+		Metadata: metadata,
+	}
+
+	if p.events.SBOMURLTemplate != "" {
+		event.SBOMURL = p.events.sbomURL(metadata)
+		return event, nil
+	}
+
+	if p.artifacts != nil && len(sbomData) > p.offloadThreshold {
+		ref, err := p.artifacts.Put(ctx, sbomData, sbomMediaType(metadata.SbomFormat))
+		if err != nil {
+			return event, failure.New(failure.CategoryStorage, fmt.Errorf("failed to offload SBOM: %w", err))
+		}
+		event.SBOMRef = ref
+		return event, nil
+	}
+
+	event.SBOM = json.RawMessage(sbomData)
+
+	return event, nil
+}
+
+// encodeScanRequestEvent encodes the event according to the configured format
+func (c EventConfig) encodeScanRequestEvent(event SbomScanRequestEvent, subject string) (rabbitmq.Message, error) {
+	if c.Format != EventFormatCloudEvents {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return rabbitmq.Message{}, fmt.Errorf("failed to marshal scan request event: %w", err)
+		}
+		return rabbitmq.Message{Body: body}, nil
+	}
+
+	ce, err := cloudevents.New(c.Source, c.Type, subject, event)
+	if err != nil {
+		return rabbitmq.Message{}, err
+	}
+
+	if c.ContentMode == cloudevents.ModeBinary {
+		body, contentType, headers := ce.Binary()
+		return rabbitmq.Message{Body: body, ContentType: contentType, Headers: headers}, nil
+	}
+
+	body, contentType, err := ce.Structured()
+	if err != nil {
+		return rabbitmq.Message{}, err
+	}
+	return rabbitmq.Message{Body: body, ContentType: contentType}, nil
+}
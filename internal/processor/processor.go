@@ -4,39 +4,92 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/CycloneDX/cyclonedx-go"
+	"github.com/google/uuid"
+	"github.com/zcubbs/sbomer/config"
+	"github.com/zcubbs/sbomer/internal/artifact"
 	"github.com/zcubbs/sbomer/internal/db"
+	dbmodels "github.com/zcubbs/sbomer/internal/db/models"
+	"github.com/zcubbs/sbomer/internal/failure"
 	"github.com/zcubbs/sbomer/internal/gitlab"
+	"github.com/zcubbs/sbomer/internal/logging"
+	"github.com/zcubbs/sbomer/internal/metrics"
 	"github.com/zcubbs/sbomer/internal/models"
+	"github.com/zcubbs/sbomer/internal/proc"
 	"github.com/zcubbs/sbomer/internal/syft"
+	"github.com/zcubbs/sbomer/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/zcubbs/sbomer/internal/rabbitmq"
 )
 
 type Message struct {
-	ProjectID int `json:"project_id"`
+	// Instance names the GitLab instance of the project; empty for the default instance
+	Instance  string `json:"instance,omitempty"`
+	ProjectID int    `json:"project_id"`
+	JobID     string `json:"job_id,omitempty"`
 }
 
 type Processor struct {
 	db     *db.DB
-	gitlab *gitlab.Client
+	gitlab map[string]*gitlab.Client
 	syft   *syft.Generator
+	events EventConfig
+	logger *slog.Logger
+
+	// workerID identifies this processor instance in job records
+	workerID string
+
+	maxAttempts int
+	retryDelay  time.Duration
+
+	cloneTimeout    time.Duration
+	generateTimeout time.Duration
+
+	artifacts        artifact.Store
+	offloadThreshold int
+}
+
+type Config struct {
+	DB *db.DB
+	// GitLab holds a client per GitLab instance name
+	GitLab   map[string]*gitlab.Client
+	Syft     *syft.Generator
+	Events   EventConfig
+	Logger   *slog.Logger
+	WorkerID string
+
+	// MaxAttempts bounds how often a job failing with a retryable error is attempted
+	MaxAttempts int
+	RetryDelay  time.Duration
+
+	// CloneTimeout and GenerateTimeout bound the clone and generate stages; zero disables them
+	CloneTimeout    time.Duration
+	GenerateTimeout time.Duration
+
+	// Artifacts receives SBOMs larger than OffloadThreshold bytes; nil disables offloading
+	Artifacts        artifact.Store
+	OffloadThreshold int
 }
 
 type SbomScanRequestEvent struct {
-	Metadata Metadata       `json:"metadata"`
-	SBOM     *cyclonedx.BOM `json:"sbom"`
+	Metadata Metadata        `json:"metadata"`
+	SBOM     json.RawMessage `json:"sbom,omitempty"`
+	SBOMURL  string          `json:"sbomUrl,omitempty"`
+	SBOMRef  *artifact.Ref   `json:"sbomRef,omitempty"`
 }
 
 type Metadata struct {
+	Instance      string   `json:"instance"`
 	ProjectId     string   `json:"projectId"`
 	ProjectTitle  string   `json:"projectTitle"`
 	ProjectUrl    string   `json:"projectUrl"`
@@ -47,130 +100,436 @@ type Metadata struct {
 	SbomFormat    string   `json:"sbomFormat"`
 	Version       string   `json:"version"`
 	TopicsId      []string `json:"topicsId"`
+
+	// Ownership and metadata of the project, omitted when they could not be looked up
+	Namespace        string                  `json:"namespace,omitempty"`
+	Visibility       string                  `json:"visibility,omitempty"`
+	LastActivityAt   *time.Time              `json:"lastActivityAt,omitempty"`
+	Maintainers      []gitlab.Maintainer     `json:"maintainers,omitempty"`
+	CodeOwners       []gitlab.CodeOwnersRule `json:"codeOwners,omitempty"`
+	Languages        map[string]float32      `json:"languages,omitempty"`
+	CustomAttributes map[string]string       `json:"customAttributes,omitempty"`
 }
 
-func New(database *db.DB, gitlabClient *gitlab.Client, syftGenerator *syft.Generator) *Processor {
+func New(config Config) *Processor {
 	return &Processor{
-		db:     database,
-		gitlab: gitlabClient,
-		syft:   syftGenerator,
+		db:     config.DB,
+		gitlab: config.GitLab,
+		syft:   config.Syft,
+		events: config.Events,
+		logger: logging.Component(config.Logger, "processor"),
+
+		workerID: config.WorkerID,
+
+		maxAttempts: config.MaxAttempts,
+		retryDelay:  config.RetryDelay,
+
+		cloneTimeout:    config.CloneTimeout,
+		generateTimeout: config.GenerateTimeout,
+
+		artifacts:        config.Artifacts,
+		offloadThreshold: config.OffloadThreshold,
 	}
 }
 
-func parseSBOM(sbomData []byte) (*cyclonedx.BOM, error) {
-	decoder := cyclonedx.NewBOMDecoder(bytes.NewReader(sbomData), cyclonedx.BOMFileFormatJSON)
+// formatCycloneDXJSON is the syft output format whose components are counted
+const formatCycloneDXJSON = "cyclonedx-json"
 
-	var bom cyclonedx.BOM
+// observeComponents records the number of components of a CycloneDX SBOM. SBOMs in other
+// formats are not counted, and one that cannot be parsed is only logged.
+func (p *Processor) observeComponents(sbomData []byte, logger *slog.Logger) {
+	if p.syft.Format() != formatCycloneDXJSON {
+		return
+	}
 
+	var bom cyclonedx.BOM
+	decoder := cyclonedx.NewBOMDecoder(bytes.NewReader(sbomData), cyclonedx.BOMFileFormatJSON)
 	if err := decoder.Decode(&bom); err != nil {
-		return nil, err
+		logger.Warn("failed to parse SBOM for its component count", logging.Err(err))
+		return
+	}
+	if bom.Components != nil {
+		metrics.SBOMComponents.Observe(float64(len(*bom.Components)))
+	}
+}
+
+// stage is a processing step of a job
+type stage struct {
+	name  string
+	state dbmodels.JobState
+}
+
+var (
+	stageClone    = stage{name: "clone", state: dbmodels.JobCloning}
+	stageGenerate = stage{name: "generate", state: dbmodels.JobGenerating}
+	stageStore    = stage{name: "store", state: dbmodels.JobStoring}
+	stagePublish  = stage{name: "publish", state: dbmodels.JobPublishing}
+)
+
+// stageError records the stage in which processing failed
+type stageError struct {
+	stage stage
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+// RetryError is returned by ProcessMessage when processing failed with a retryable
+// error and the job has attempts left; the message should be requeued after Delay
+type RetryError struct {
+	Err     error
+	Attempt int
+	Delay   time.Duration
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("attempt %d failed: %v", e.Attempt, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// runStage runs one processing stage inside its own span, recording its start and
+// duration on the job and counting failures by stage
+func (p *Processor) runStage(ctx context.Context, jobID string, st stage, fn func(context.Context) error) error {
+	logger := p.logger.With(logging.JobID(jobID), logging.Operation(st.name))
+
+	if err := p.db.StartJobStage(ctx, jobID, st.state); err != nil {
+		logger.Warn("failed to record job stage start", logging.Err(err))
+	}
+
+	ctx, span := tracing.Start(ctx, st.name)
+	startTime := time.Now()
+	err := fn(ctx)
+	duration := time.Since(startTime)
+	tracing.End(span, err)
+
+	if err := p.db.FinishJobStage(ctx, jobID, st.state, duration); err != nil {
+		logger.Warn("failed to record job stage duration", logging.Err(err))
+	}
+
+	if err != nil {
+		metrics.MessageFailures.WithLabelValues(st.name, string(failure.CategoryOf(err))).Inc()
+		return &stageError{stage: st, err: err}
+	}
+	return nil
+}
+
+// retry decides whether a failed attempt of a job is retried, returning a RetryError if so
+func (p *Processor) retry(err error, attempts int) error {
+	// Work interrupted by shutdown is always retried
+	if failure.CategoryOf(err) == failure.CategoryCanceled {
+		return &RetryError{Err: err, Attempt: attempts}
+	}
+
+	if attempts >= failure.CategoryOf(err).MaxAttempts(p.maxAttempts) {
+		return err
 	}
 
-	return &bom, nil
+	// Back off linearly with the number of attempts
+	return &RetryError{
+		Err:     err,
+		Attempt: attempts,
+		Delay:   time.Duration(attempts) * p.retryDelay,
+	}
 }
 
-func (p *Processor) ProcessMessage(ctx context.Context, data []byte, workerScannerConsumer *rabbitmq.Consumer) error {
+// finishJob records the outcome of a job, requeueing it or recording the failure category
+// if there was one
+func (p *Processor) finishJob(ctx context.Context, jobID string, err error, logger *slog.Logger) {
+	// Record the outcome even if processing was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	if err == nil {
+		if err := p.db.FinishJob(ctx, jobID, dbmodels.JobDone); err != nil {
+			logger.Warn("failed to record job completion", logging.Err(err))
+		}
+		return
+	}
+
+	var failedStage dbmodels.JobState
+	var stageErr *stageError
+	if errors.As(err, &stageErr) {
+		failedStage = stageErr.stage.state
+	}
+
+	category := failure.CategoryOf(err)
+
+	var retryErr *RetryError
+	if errors.As(err, &retryErr) {
+		metrics.MessageRequeues.WithLabelValues(string(category)).Inc()
+		if err := p.db.RequeueJob(ctx, jobID, failedStage, string(category), retryErr.Err.Error()); err != nil {
+			logger.Warn("failed to record job retry", logging.Err(err))
+		}
+		return
+	}
+
+	if err := p.db.FailJob(ctx, jobID, failedStage, string(category), err.Error()); err != nil {
+		logger.Warn("failed to record job failure", logging.Err(err))
+	}
+}
+
+// supersedingJob records the commit a job cloned and returns the ID of a newer job for
+// the same commit that is being processed or done, or "" if there is none
+func (p *Processor) supersedingJob(ctx context.Context, jobID string, details *gitlab.ProjectDetails, logger *slog.Logger) string {
+	if details.CommitSHA == "" {
+		return ""
+	}
+
+	if err := p.db.SetJobCommit(ctx, jobID, details.CommitBranch, details.CommitSHA); err != nil {
+		logger.Warn("failed to record job commit", logging.Err(err))
+		return ""
+	}
+
+	newerID, err := p.db.FindSupersedingJob(ctx, jobID)
+	if err != nil {
+		logger.Warn("failed to look up newer jobs", logging.Err(err))
+		return ""
+	}
+	return newerID
+}
+
+// enrichProject looks up the ownership and metadata of a cloned project and saves them.
+// Both are best effort: the SBOM is generated and published without what failed.
+func (p *Processor) enrichProject(ctx context.Context, client *gitlab.Client, instance string, details *gitlab.ProjectDetails, repoPath string, logger *slog.Logger) {
+	ctx, span := tracing.Start(ctx, "enrich")
+	err := client.EnrichProject(ctx, details, repoPath)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Warn("failed to look up project ownership", logging.Operation("enrich"), logging.Err(err))
+	}
+
+	project := &dbmodels.Project{
+		Instance:         instance,
+		ProjectID:        details.ID,
+		Name:             details.Name,
+		Path:             details.Path,
+		Namespace:        details.Namespace,
+		Visibility:       details.Visibility,
+		DefaultBranch:    details.CommitBranch,
+		Topics:           details.Topics,
+		LastActivityAt:   details.LastActivityAt,
+		Languages:        details.Languages,
+		CustomAttributes: details.CustomAttributes,
+	}
+	// Lookups that failed stay NULL, which keeps their last saved value
+	if details.Maintainers != nil {
+		project.Maintainers, _ = json.Marshal(details.Maintainers)
+	}
+	if details.CodeOwners != nil {
+		project.CodeOwners, _ = json.Marshal(details.CodeOwners)
+	}
+
+	if err := p.db.SaveProject(ctx, project); err != nil {
+		logger.Warn("failed to save project", logging.Operation("enrich"), logging.Err(err))
+	}
+}
+
+// skipJob records that a job was skipped in favor of a newer one
+func (p *Processor) skipJob(ctx context.Context, jobID string, supersededBy string, logger *slog.Logger) {
+	metrics.JobsSuperseded.Inc()
+	if err := p.db.SkipJob(context.WithoutCancel(ctx), jobID, supersededBy); err != nil {
+		logger.Warn("failed to record skipped job", logging.Err(err))
+	}
+}
+
+func (p *Processor) ProcessMessage(ctx context.Context, data []byte, workerScannerConsumer *rabbitmq.Consumer) (err error) {
 	var msg Message
 	if err := json.Unmarshal(data, &msg); err != nil {
-		return fmt.Errorf("failed to unmarshal message: %w", err)
+		return failure.New(failure.CategoryMalformedInput, fmt.Errorf("failed to unmarshal message: %w", err))
 	}
 
-	// Log operation start
-	if err := p.db.LogOperation(ctx, msg.ProjectID, "clone", "started", ""); err != nil {
-		log.Printf("Failed to log operation start: %v", err)
+	// Messages published without a job get one now
+	if msg.JobID == "" {
+		msg.JobID = uuid.NewString()
+	}
+	if msg.Instance == "" {
+		msg.Instance = config.DefaultInstance
 	}
 
-	// Clone repository
-	repoPath, cloneUrl, details, err := p.gitlab.CloneProject(msg.ProjectID)
+	ctx, span := tracing.Start(ctx, "process project",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("sbomer.instance", msg.Instance),
+			attribute.Int("sbomer.project.id", msg.ProjectID),
+			attribute.String("sbomer.job.id", msg.JobID),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	logger := p.logger.With(logging.Instance(msg.Instance), logging.ProjectID(msg.ProjectID), logging.JobID(msg.JobID))
+	startTime := time.Now()
+
+	attempts, err := p.db.StartJob(ctx, msg.JobID, msg.Instance, msg.ProjectID, p.workerID)
 	if err != nil {
-		err := p.db.LogOperation(ctx, msg.ProjectID, "clone", "failed", err.Error())
+		// Without a job record attempts cannot be counted, so retry until the database is back
+		return &RetryError{Err: failure.New(failure.CategoryStorage, err), Delay: p.retryDelay}
+	}
+	logger.Info("processing project", slog.Int("attempt", attempts))
+	var supersededBy string
+	defer func() {
 		if err != nil {
-			return fmt.Errorf("failed to log clone failure: %w", err)
+			err = p.retry(err, attempts)
+		}
+		if err == nil && supersededBy != "" {
+			p.skipJob(ctx, msg.JobID, supersededBy, logger)
+			return
 		}
-		return fmt.Errorf("failed to clone repository: %w", err)
+		p.finishJob(ctx, msg.JobID, err, logger)
+	}()
+
+	gitlabClient, ok := p.gitlab[msg.Instance]
+	if !ok {
+		return failure.Newf(failure.CategoryConfiguration, "unknown GitLab instance %q", msg.Instance)
+	}
+
+	// Clone repository
+	var repoPath, cloneUrl string
+	var details *gitlab.ProjectDetails
+	err = p.runStage(ctx, msg.JobID, stageClone, func(ctx context.Context) error {
+		ctx, cancel := proc.WithTimeout(ctx, p.cloneTimeout)
+		defer cancel()
+
+		var err error
+		repoPath, cloneUrl, details, err = gitlabClient.CloneProject(ctx, msg.ProjectID)
+		if err != nil {
+			return fmt.Errorf("failed to clone repository: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	defer func() {
-		if err := p.gitlab.CleanupRepository(repoPath); err != nil {
-			log.Printf("Failed to cleanup repository: %v", err)
+		if err := gitlabClient.CleanupRepository(repoPath); err != nil {
+			logger.Warn("failed to cleanup repository", logging.Operation("cleanup"), logging.Err(err))
 		}
 	}()
+	span.SetAttributes(
+		attribute.String("sbomer.project.path", details.Path),
+		attribute.String("sbomer.commit.sha", details.CommitSHA),
+	)
 
-	// Log clone success
-	if err := p.db.LogOperation(ctx, msg.ProjectID, "clone", "success", ""); err != nil {
-		log.Printf("Failed to log clone success: %v", err)
+	// Drop the delivery if a newer job already scans or scanned the same commit
+	supersededBy = p.supersedingJob(ctx, msg.JobID, details, logger)
+	if supersededBy != "" {
+		logger.Info("skipping job superseded by a newer job",
+			slog.String("commit_sha", details.CommitSHA),
+			slog.String("superseded_by", supersededBy),
+		)
+		return nil
 	}
 
-	// Create output path for SBOM
-	sbomPath := filepath.Join(repoPath, "sbom.json")
+	p.enrichProject(ctx, gitlabClient, msg.Instance, details, repoPath, logger)
 
 	// Generate SBOM
-	err = p.syft.GenerateSBOM(repoPath, sbomPath)
-	if err != nil {
-		err := p.db.LogOperation(ctx, msg.ProjectID, "sbom", "failed", err.Error())
+	var sbomData []byte
+	err = p.runStage(ctx, msg.JobID, stageGenerate, func(ctx context.Context) error {
+		ctx, cancel := proc.WithTimeout(ctx, p.generateTimeout)
+		defer cancel()
+
+		// Write the SBOM outside the read-only checkout
+		sbomFile, err := os.CreateTemp("", "sbomer-sbom-*.json")
 		if err != nil {
-			return fmt.Errorf("failed to log SBOM failure: %w", err)
+			return failure.New(failure.CategoryOf(err), fmt.Errorf("failed to create SBOM file: %w", err))
+		}
+		sbomPath := sbomFile.Name()
+		sbomFile.Close()
+		defer os.Remove(sbomPath)
+
+		if err := p.syft.GenerateSBOM(ctx, repoPath, sbomPath); err != nil {
+			return fmt.Errorf("failed to generate SBOM: %w", err)
 		}
-		return fmt.Errorf("failed to generate SBOM: %w", err)
-	}
 
-	// Read generated SBOM file
-	sbomData, err := os.ReadFile(sbomPath)
+		// Read generated SBOM file
+		sbomData, err = os.ReadFile(sbomPath)
+		if err != nil {
+			return failure.New(failure.CategoryToolCrash, fmt.Errorf("failed to read SBOM file: %w", err))
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to read SBOM file: %w", err)
+		return err
 	}
 
-	// Store SBOM in database
-	sbom := &models.SBOM{
-		ProjectUID: details.ID,
-		Name:       details.Name,
-		Path:       details.Path,
-		Topics:     details.Topics,
-		SBOMData:   json.RawMessage(sbomData),
-	}
+	metrics.SBOMSize.Observe(float64(len(sbomData)))
+	p.observeComponents(sbomData, logger)
 
-	if err := p.db.SaveSBOM(ctx, sbom); err != nil {
-		return fmt.Errorf("failed to save SBOM: %w", err)
-	}
+	// Store SBOM in database
+	err = p.runStage(ctx, msg.JobID, stageStore, func(ctx context.Context) error {
+		sbom := &models.SBOM{
+			Instance:   msg.Instance,
+			ProjectUID: details.ID,
+			Name:       details.Name,
+			Path:       details.Path,
+			Topics:     details.Topics,
+			SBOMData:   json.RawMessage(sbomData),
+		}
 
-	// Log SBOM generation success
-	if err := p.db.LogOperation(ctx, msg.ProjectID, "sbom", "success", ""); err != nil {
-		log.Printf("Failed to log SBOM success: %v", err)
+		if err := p.db.SaveSBOM(ctx, sbom); err != nil {
+			return failure.New(failure.CategoryStorage, fmt.Errorf("failed to save SBOM: %w", err))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	// Create metadata
 	metadata := Metadata{
+		Instance:      msg.Instance,
 		ProjectId:     strconv.Itoa(msg.ProjectID),
 		ProjectTitle:  details.Name,
 		ProjectUrl:    strings.TrimSuffix(cloneUrl, ".git"),
-		JobId:         "1",
+		JobId:         msg.JobID,
 		CommitBranch:  details.CommitBranch,
 		Source:        "sbomer",
 		GeneratedDate: time.Now().Format("2006-01-02"),
-		SbomFormat:    "cyclonedx-json",
+		SbomFormat:    p.syft.Format(),
 		Version:       "1.0",
 		TopicsId:      details.Topics,
-	}
 
-	bom, err := parseSBOM(sbomData)
-
-	// Create SBOM scan request event
-	sbomScanRequestEvent := SbomScanRequestEvent{
-		Metadata: metadata,
-		SBOM:     bom,
+		Namespace:        details.Namespace,
+		Visibility:       details.Visibility,
+		LastActivityAt:   details.LastActivityAt,
+		Maintainers:      details.Maintainers,
+		CodeOwners:       details.CodeOwners,
+		Languages:        details.Languages,
+		CustomAttributes: details.CustomAttributes,
 	}
 
-	// Publish metadata to RabbitMQ
-	sbomScanRequestEventBytes, err := json.Marshal(sbomScanRequestEvent)
+	// Publish SBOM scan request event to RabbitMQ
+	err = p.runStage(ctx, msg.JobID, stagePublish, func(ctx context.Context) error {
+		sbomScanRequestEvent, err := p.newScanRequestEvent(ctx, metadata, sbomData)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %w", err)
-	}
+		eventMessage, err := p.events.encodeScanRequestEvent(sbomScanRequestEvent, details.Path)
+		if err != nil {
+			return fmt.Errorf("failed to encode metadata: %w", err)
+		}
 
-	if err := workerScannerConsumer.Publish(ctx, sbomScanRequestEventBytes); err != nil {
-		return fmt.Errorf("failed to publish metadata: %w", err)
+		if err := workerScannerConsumer.PublishMessage(ctx, eventMessage); err != nil {
+			return failure.New(failure.CategoryQueue, fmt.Errorf("failed to publish metadata: %w", err))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("🚀 Published SBOM scan request event for project %d\n", msg.ProjectID)
+	logger.Info("published SBOM scan request event",
+		logging.Operation("publish"),
+		logging.Duration(time.Since(startTime)),
+	)
 
 	return nil
 }
@@ -3,7 +3,12 @@ package rabbitmq
 import (
 	"context"
 	"fmt"
+	"time"
+
 	"github.com/rabbitmq/amqp091-go"
+	"github.com/zcubbs/sbomer/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Consumer struct {
@@ -16,6 +21,15 @@ type Consumer struct {
 	prefetchCount int
 }
 
+// Message is an outgoing message with optional content type, headers and priority
+type Message struct {
+	Body        []byte
+	ContentType string
+	Headers     map[string]interface{}
+	// Priority orders messages in a queue declared with a max priority; higher goes first
+	Priority uint8
+}
+
 type ConsumerConfig struct {
 	URI           string
 	Exchange      string
@@ -23,6 +37,9 @@ type ConsumerConfig struct {
 	RoutingKey    string
 	ConsumerGroup string
 	PrefetchCount int
+	// MaxPriority declares the queue as a priority queue with priorities up to this
+	// value; zero declares a plain queue
+	MaxPriority int
 }
 
 func New(config ConsumerConfig) (*Consumer, error) {
@@ -69,14 +86,19 @@ func New(config ConsumerConfig) (*Consumer, error) {
 		return nil, fmt.Errorf("failed to declare exchange: %w", err)
 	}
 
-	// Declare queue for the consumer group
+	// Declare queue for the consumer group. RabbitMQ refuses to redeclare an existing
+	// queue with different arguments, so all clients must agree on MaxPriority.
+	var queueArgs amqp091.Table
+	if config.MaxPriority > 0 {
+		queueArgs = amqp091.Table{"x-max-priority": config.MaxPriority}
+	}
 	queue, err := ch.QueueDeclare(
 		config.ConsumerGroup, // name - using consumer group as queue name
 		true,                 // durable
 		false,                // delete when unused
 		false,                // exclusive
 		false,                // no-wait
-		nil,                  // arguments
+		queueArgs,            // arguments
 	)
 	if err != nil {
 		ch.Close()
@@ -118,6 +140,17 @@ func (c *Consumer) Close() {
 	}
 }
 
+// Ping reports an error if the connection or channel to RabbitMQ is closed
+func (c *Consumer) Ping(ctx context.Context) error {
+	if c.conn == nil || c.conn.IsClosed() {
+		return fmt.Errorf("connection to RabbitMQ is closed")
+	}
+	if c.channel == nil || c.channel.IsClosed() {
+		return fmt.Errorf("channel to RabbitMQ is closed")
+	}
+	return nil
+}
+
 func (c *Consumer) Consume(ctx context.Context) (<-chan amqp091.Delivery, error) {
 	// Each consumer in the group gets its own consumer tag
 	consumerTag := fmt.Sprintf("%s-%d", c.consumerGroup, c.prefetchCount)
@@ -133,17 +166,103 @@ func (c *Consumer) Consume(ctx context.Context) (<-chan amqp091.Delivery, error)
 	)
 }
 
-// Publish sends a message to the exchange
+// Retry acks a delivery after republishing it to a delay queue that dead-letters it back
+// to the consumer group's queue once delay has passed, so that the delivery does not
+// hold a prefetch slot while it waits. There is a delay queue per delay, so that a long
+// delay never holds up a shorter one; each is deleted once unused for a minute past its
+// delay. The delivery is left unacked if it cannot be republished.
+func (c *Consumer) Retry(ctx context.Context, delivery amqp091.Delivery, delay time.Duration) error {
+	ttl := delay.Milliseconds()
+	if ttl <= 0 {
+		return delivery.Nack(false, true)
+	}
+
+	queue, err := c.channel.QueueDeclare(
+		fmt.Sprintf("%s.retry.%d", c.consumerGroup, ttl), // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		amqp091.Table{
+			"x-message-ttl":             ttl,
+			"x-expires":                 ttl + time.Minute.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": c.consumerGroup,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare retry queue: %w", err)
+	}
+
+	// The default exchange routes to the queue named by the routing key
+	err = c.channel.PublishWithContext(ctx,
+		"",         // exchange
+		queue.Name, // routing key
+		false,      // mandatory
+		false,      // immediate
+		amqp091.Publishing{
+			ContentType:  delivery.ContentType,
+			Headers:      delivery.Headers,
+			Body:         delivery.Body,
+			DeliveryMode: amqp091.Persistent,
+			Priority:     delivery.Priority,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish to retry queue: %w", err)
+	}
+
+	return delivery.Ack(false)
+}
+
+// IsRetry reports whether a delivery is another attempt at a message: either requeued
+// and redelivered, or dead-lettered back from a delay queue by Retry, which RabbitMQ
+// records in the x-death header
+func IsRetry(delivery amqp091.Delivery) bool {
+	_, dead := delivery.Headers["x-death"]
+	return delivery.Redelivered || dead
+}
+
+// Publish sends a JSON message to the exchange
 func (c *Consumer) Publish(ctx context.Context, body []byte) error {
+	return c.PublishMessage(ctx, Message{Body: body})
+}
+
+// PublishMessage sends a message to the exchange, defaulting to a JSON content type.
+// The trace context of ctx is propagated in the message headers.
+func (c *Consumer) PublishMessage(ctx context.Context, msg Message) (err error) {
+	contentType := msg.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	ctx, span := tracing.Start(ctx, "publish "+c.exchange,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", c.exchange),
+			attribute.String("messaging.rabbitmq.destination.routing_key", c.routingKey),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	headers := make(map[string]interface{}, len(msg.Headers))
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	tracing.Inject(ctx, headers)
+
 	return c.channel.PublishWithContext(ctx,
 		c.exchange,   // exchange
 		c.routingKey, // routing key
 		false,        // mandatory
 		false,        // immediate
 		amqp091.Publishing{
-			ContentType:  "application/json",
-			Body:         body,
+			ContentType:  contentType,
+			Headers:      amqp091.Table(headers),
+			Body:         msg.Body,
 			DeliveryMode: amqp091.Persistent,
+			Priority:     msg.Priority,
 		},
 	)
 }
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/zcubbs/sbomer/internal/logging"
+)
+
+// Server is the operational HTTP server exposing metrics and probes
+type Server struct {
+	router *chi.Mux
+	http   *http.Server
+	logger *slog.Logger
+}
+
+func New(addr string, logger *slog.Logger) *Server {
+	router := chi.NewRouter()
+	router.Use(middleware.Recoverer)
+
+	return &Server{
+		router: router,
+		http: &http.Server{
+			Addr:              addr,
+			Handler:           router,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		logger: logging.Component(logger, "server"),
+	}
+}
+
+// Handle registers a handler for the given path
+func (s *Server) Handle(path string, handler http.Handler) {
+	s.router.Handle(path, handler)
+}
+
+// Start serves requests in the background until Shutdown is called
+func (s *Server) Start() {
+	go func() {
+		s.logger.Info("starting HTTP server", slog.String("addr", s.http.Addr))
+		if err := s.http.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("HTTP server stopped", logging.Err(err))
+		}
+	}()
+}
+
+// Shutdown gracefully stops the server
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.http.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shutdown HTTP server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package syft
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+
+	"github.com/zcubbs/sbomer/internal/failure"
+)
+
+// outputPatterns maps fragments of syft's output to failure categories, checked in order
+var outputPatterns = []struct {
+	fragment string
+	category failure.Category
+}{
+	{"no space left on device", failure.CategoryDiskFull},
+	{"disk quota exceeded", failure.CategoryDiskFull},
+	{"context deadline exceeded", failure.CategoryTimeout},
+	{"out of memory", failure.CategoryToolCrash},
+	{"panic:", failure.CategoryToolCrash},
+	{"unable to parse", failure.CategoryMalformedInput},
+	{"failed to parse", failure.CategoryMalformedInput},
+	{"unable to decode", failure.CategoryMalformedInput},
+	{"failed to decode", failure.CategoryMalformedInput},
+	{"invalid character", failure.CategoryMalformedInput},
+	{"unexpected eof", failure.CategoryMalformedInput},
+	{"could not determine source", failure.CategoryMalformedInput},
+	{"unable to find", failure.CategoryNotFound},
+	{"no such file or directory", failure.CategoryNotFound},
+}
+
+// classifyError categorizes a failed syft run from its exit status and output
+func classifyError(err error, output string) failure.Category {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		// syft could not be started at all
+		return failure.CategoryConfiguration
+	}
+
+	// syft was killed by a signal, typically by the OOM killer
+	if exitErr.ExitCode() == -1 {
+		return failure.CategoryToolCrash
+	}
+
+	lower := strings.ToLower(output)
+	for _, pattern := range outputPatterns {
+		if strings.Contains(lower, pattern.fragment) {
+			return pattern.category
+		}
+	}
+
+	return failure.CategoryToolCrash
+}
@@ -1,21 +1,42 @@
 package syft
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
+
+	"github.com/zcubbs/sbomer/internal/failure"
+	"github.com/zcubbs/sbomer/internal/logging"
+	"github.com/zcubbs/sbomer/internal/metrics"
+	"github.com/zcubbs/sbomer/internal/proc"
 )
 
 type Generator struct {
 	format      string
 	syftBinPath string
+	logger      *slog.Logger
+	limits      proc.Limits
+}
+
+type Config struct {
+	Format      string
+	SyftBinPath string
+	Logger      *slog.Logger
+
+	// Limits are the resource limits of syft processes
+	Limits proc.Limits
 }
 
-func New(format, syftBinPath string) *Generator {
+func New(config Config) *Generator {
 	return &Generator{
-		format:      format,
-		syftBinPath: syftBinPath,
+		format:      config.Format,
+		syftBinPath: config.SyftBinPath,
+		logger:      logging.Component(config.Logger, "syft"),
+		limits:      config.Limits,
 	}
 }
 
@@ -45,32 +66,66 @@ func (g *Generator) findSyftBinary() (string, error) {
 	return absPath, nil
 }
 
+// Format returns the syft output format SBOMs are generated in
+func (g *Generator) Format() string {
+	return g.format
+}
+
+// Ping verifies that the syft binary can be found
+func (g *Generator) Ping(ctx context.Context) error {
+	_, err := g.findSyftBinary()
+	return err
+}
+
 // containsPathSeparator checks if a string contains a path separator
 func containsPathSeparator(path string) bool {
 	return path != filepath.Base(path)
 }
 
-func (g *Generator) GenerateSBOM(projectPath string, outputPath string) error {
+// GenerateSBOM runs syft on projectPath and writes the SBOM to outputPath. syft is
+// terminated when ctx is done.
+func (g *Generator) GenerateSBOM(ctx context.Context, projectPath string, outputPath string) error {
 	syftPath, err := g.findSyftBinary()
 	if err != nil {
-		return err
+		return failure.New(failure.CategoryConfiguration, err)
 	}
 
 	// Convert paths to use correct separators for the platform
 	projectPath = filepath.Clean(projectPath)
 	outputPath = filepath.Clean(outputPath)
 
-	cmd := exec.Command(syftPath, "scan", projectPath,
+	cmd := proc.Command(ctx, syftPath, "scan", projectPath,
 		fmt.Sprintf("-o=%s=%s", g.format, outputPath))
 
-	// Set up environment
-	cmd.Env = os.Environ()
+	// Pass only what syft needs, keeping the service's credentials out of reach of the
+	// scanned repository
+	cmd.Env = proc.Env([]string{"SYFT_"})
+
+	cleanupLimits, err := proc.Apply(cmd, g.limits)
+	if err != nil {
+		return failure.New(failure.CategoryConfiguration, err)
+	}
+	defer cleanupLimits()
+
+	logger := g.logger.With(logging.Operation("generate"), slog.String("path", projectPath))
+	logger.Debug("running syft", slog.String("binary", syftPath), slog.String("format", g.format))
 
 	// Capture both stdout and stderr
+	startTime := time.Now()
 	output, err := cmd.CombinedOutput()
+	duration := time.Since(startTime)
+	metrics.SyftDuration.Observe(duration.Seconds())
 	if err != nil {
-		return fmt.Errorf("failed to generate SBOM: %w, output: %s", err, string(output))
+		if ctxErr := proc.ContextError(ctx, "syft"); ctxErr != nil {
+			logger.Error("syft interrupted", logging.Duration(duration), logging.Category(failure.CategoryOf(ctxErr)), logging.Err(ctxErr))
+			return ctxErr
+		}
+
+		category := classifyError(err, string(output))
+		logger.Error("syft failed", logging.Duration(duration), logging.Category(category), logging.Err(err))
+		return failure.New(category, fmt.Errorf("failed to generate SBOM: %w, output: %s", err, string(output)))
 	}
+	logger.Info("generated SBOM", logging.Duration(duration))
 
 	return nil
 }
@@ -0,0 +1,14 @@
+-- Documents stored only in sbom_blobs cannot be moved back into sbom_data by SQL, since
+-- they are compressed, so the rollback refuses to run rather than drop them
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM sbom WHERE sbom_data IS NULL) THEN
+        RAISE EXCEPTION 'cannot roll back sbom_blobs: % sbom rows are stored only in sbom_blobs',
+            (SELECT count(*) FROM sbom WHERE sbom_data IS NULL);
+    END IF;
+END
+$$;
+
+ALTER TABLE sbom ALTER COLUMN sbom_data SET NOT NULL;
+ALTER TABLE sbom DROP COLUMN IF EXISTS sbom_digest;
+DROP TABLE IF EXISTS sbom_blobs;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS sbom_blobs (
+    digest VARCHAR(71) PRIMARY KEY,
+    compression VARCHAR(16) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- SBOM documents move to sbom_blobs; sbom_data is kept for rows written before this migration
+ALTER TABLE sbom ADD COLUMN IF NOT EXISTS sbom_digest VARCHAR(71) REFERENCES sbom_blobs (digest);
+ALTER TABLE sbom ALTER COLUMN sbom_data DROP NOT NULL;
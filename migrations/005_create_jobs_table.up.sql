@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY,
+    project_id INTEGER NOT NULL,
+    state VARCHAR(20) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    worker_id VARCHAR(255),
+    failed_stage VARCHAR(20),
+    error_category VARCHAR(50),
+    error_message TEXT,
+    queued_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    cloning_started_at TIMESTAMP WITH TIME ZONE,
+    cloning_duration_ms BIGINT,
+    generating_started_at TIMESTAMP WITH TIME ZONE,
+    generating_duration_ms BIGINT,
+    storing_started_at TIMESTAMP WITH TIME ZONE,
+    storing_duration_ms BIGINT,
+    publishing_started_at TIMESTAMP WITH TIME ZONE,
+    publishing_duration_ms BIGINT,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_project_id ON jobs (project_id, queued_at DESC);
+CREATE INDEX IF NOT EXISTS idx_jobs_state ON jobs (state);
@@ -0,0 +1,11 @@
+ALTER TABLE fetch_stats DROP COLUMN IF EXISTS instance;
+
+DROP INDEX IF EXISTS idx_jobs_instance_project_id;
+CREATE INDEX IF NOT EXISTS idx_jobs_project_id ON jobs (project_id, queued_at DESC);
+ALTER TABLE jobs DROP COLUMN IF EXISTS instance;
+
+-- Only the default instance fits the single-column key
+DELETE FROM sbom WHERE instance <> 'default';
+ALTER TABLE sbom DROP CONSTRAINT IF EXISTS sbom_pkey;
+ALTER TABLE sbom ADD PRIMARY KEY (project_uid);
+ALTER TABLE sbom DROP COLUMN IF EXISTS instance;
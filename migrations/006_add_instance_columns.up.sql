@@ -0,0 +1,11 @@
+-- Project IDs are only unique within a GitLab instance; rows written before this
+-- migration belong to the default instance
+ALTER TABLE sbom ADD COLUMN IF NOT EXISTS instance VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE sbom DROP CONSTRAINT IF EXISTS sbom_pkey;
+ALTER TABLE sbom ADD PRIMARY KEY (instance, project_uid);
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS instance VARCHAR(64) NOT NULL DEFAULT 'default';
+DROP INDEX IF EXISTS idx_jobs_project_id;
+CREATE INDEX IF NOT EXISTS idx_jobs_instance_project_id ON jobs (instance, project_id, queued_at DESC);
+
+ALTER TABLE fetch_stats ADD COLUMN IF NOT EXISTS instance VARCHAR(64) NOT NULL DEFAULT 'default';
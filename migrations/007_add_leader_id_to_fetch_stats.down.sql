@@ -0,0 +1 @@
+ALTER TABLE fetch_stats DROP COLUMN IF EXISTS leader_id;
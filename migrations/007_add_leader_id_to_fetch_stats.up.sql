@@ -0,0 +1,2 @@
+-- Replica that held the fetcher leader lock while the batch was fetched
+ALTER TABLE fetch_stats ADD COLUMN IF NOT EXISTS leader_id VARCHAR(255);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_jobs_instance_project_commit;
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS superseded_by;
+ALTER TABLE jobs DROP COLUMN IF EXISTS commit_sha;
+ALTER TABLE jobs DROP COLUMN IF EXISTS ref;
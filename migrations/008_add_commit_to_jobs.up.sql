@@ -0,0 +1,6 @@
+-- Commit a job scanned, for dropping deliveries a newer job already covers
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS ref VARCHAR(255);
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS commit_sha VARCHAR(64);
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS superseded_by UUID;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_instance_project_commit ON jobs (instance, project_id, commit_sha);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_fetch_stats_cycle_id;
+ALTER TABLE fetch_stats DROP COLUMN IF EXISTS cycle_id;
+
+DROP TABLE IF EXISTS fetch_checkpoints;
+DROP TABLE IF EXISTS fetch_cycles;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS fetch_cycles (
+    id UUID PRIMARY KEY,
+    instance VARCHAR(64) NOT NULL,
+    leader_id VARCHAR(255),
+    state VARCHAR(20) NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_fetch_cycles_instance_state ON fetch_cycles (instance, state, started_at DESC);
+
+-- Progress of a cycle through one group; group_id is empty when all projects are listed
+CREATE TABLE IF NOT EXISTS fetch_checkpoints (
+    cycle_id UUID NOT NULL REFERENCES fetch_cycles (id) ON DELETE CASCADE,
+    group_id VARCHAR(255) NOT NULL,
+    page INTEGER NOT NULL DEFAULT 0,
+    cursor TEXT,
+    projects_count INTEGER NOT NULL DEFAULT 0,
+    done BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (cycle_id, group_id)
+);
+
+ALTER TABLE fetch_stats ADD COLUMN IF NOT EXISTS cycle_id UUID;
+CREATE INDEX IF NOT EXISTS idx_fetch_stats_cycle_id ON fetch_stats (cycle_id);
@@ -0,0 +1 @@
+ALTER TABLE fetch_stats DROP COLUMN IF EXISTS group_id;
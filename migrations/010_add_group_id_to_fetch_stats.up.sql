@@ -0,0 +1,2 @@
+-- Group or project ID range the batch was fetched from; groups are fetched concurrently
+ALTER TABLE fetch_stats ADD COLUMN IF NOT EXISTS group_id VARCHAR(255);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_fetch_cycles_instance_schedule_state;
+CREATE INDEX IF NOT EXISTS idx_fetch_cycles_instance_state ON fetch_cycles (instance, state, started_at DESC);
+
+ALTER TABLE fetch_cycles DROP COLUMN IF EXISTS schedule;
@@ -0,0 +1,5 @@
+-- Each schedule of an instance runs, and resumes, cycles of its own
+ALTER TABLE fetch_cycles ADD COLUMN IF NOT EXISTS schedule VARCHAR(64) NOT NULL DEFAULT 'default';
+
+DROP INDEX IF EXISTS idx_fetch_cycles_instance_state;
+CREATE INDEX IF NOT EXISTS idx_fetch_cycles_instance_schedule_state ON fetch_cycles (instance, schedule, state, started_at DESC);
@@ -0,0 +1,22 @@
+-- Ownership and metadata of projects, refreshed whenever a project is processed
+CREATE TABLE IF NOT EXISTS projects (
+    instance VARCHAR(64) NOT NULL,
+    project_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    namespace VARCHAR(255),
+    visibility VARCHAR(20),
+    default_branch VARCHAR(255),
+    topics TEXT[] NOT NULL DEFAULT '{}',
+    last_activity_at TIMESTAMP WITH TIME ZONE,
+    maintainers JSONB,
+    code_owners JSONB,
+    languages JSONB,
+    custom_attributes JSONB,
+    enriched_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (instance, project_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_projects_instance_namespace ON projects (instance, namespace);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_projects_deleted_at;
+DROP INDEX IF EXISTS idx_projects_instance_group_id;
+
+ALTER TABLE projects DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE projects DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE projects DROP COLUMN IF EXISTS group_id;
+ALTER TABLE projects DROP COLUMN IF EXISTS schedule;
+ALTER TABLE projects DROP COLUMN IF EXISTS filter_decision;
+ALTER TABLE projects DROP COLUMN IF EXISTS archived;
@@ -0,0 +1,11 @@
+-- The fetcher records every project it lists; group_id is the group it was last listed
+-- under and is NULL when all projects of the instance are listed
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS filter_decision VARCHAR(32);
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS schedule VARCHAR(64);
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS group_id VARCHAR(255);
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_projects_instance_group_id ON projects (instance, group_id);
+CREATE INDEX IF NOT EXISTS idx_projects_deleted_at ON projects (deleted_at) WHERE deleted_at IS NOT NULL;